@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+
+	"github.com/spf13/cobra"
+)
+
+var ackCmd = &cobra.Command{
+	Use:   "ack",
+	Short: "Acknowledges (clears) the active alert of the logwatch pattern",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
+			return sendViaIPC(cmd)
+		}
+
+		logwatch := patterns.Get("logwatch").(*patterns.LogwatchPattern)
+		acked, err := logwatch.Ack()
+		if err != nil {
+			return err
+		}
+
+		if !acked {
+			cmd.Println("no active alert")
+			return nil
+		}
+
+		cmd.Println("alert acknowledged")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ackCmd)
+}
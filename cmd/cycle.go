@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var cycleCmd = &cobra.Command{
+	Use:   "cycle",
+	Short: "Runs the pattern following the one currently running from a list of patterns",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
+			return sendViaIPC(cmd)
+		}
+
+		names := viper.GetStringSlice("cycle.patterns")
+		if len(names) == 0 {
+			return fail(11, "no patterns to cycle through")
+		}
+
+		next := 0
+		if running := patterns.GetRunning(); running != nil {
+			for i, name := range names {
+				if name == running.GetBase().Name {
+					next = (i + 1) % len(names)
+					break
+				}
+			}
+		}
+
+		pattern := patterns.Get(names[next])
+		if pattern == nil {
+			return fail(12, fmt.Errorf("unknown pattern: %s", names[next]))
+		}
+
+		idle := viper.GetString(names[next] + "." + patterns.IdleLabel)
+		if err := requireInvokingPeer(cmd, names[next], idle); err != nil {
+			return err
+		}
+
+		cmd.Println("running =", pattern)
+		return pattern.Run(cmd.Context(), &log.Logger)
+	},
+}
+
+func init() {
+	cycleCmd.Flags().StringSlice("patterns", []string{"rainbow", "pulse", "random", "cpu", "typing"}, "the patterns to cycle through")
+	viper.BindPFlag("cycle.patterns", cycleCmd.Flags().Lookup("patterns"))
+
+	rootCmd.AddCommand(cycleCmd)
+}
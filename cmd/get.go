@@ -1,17 +1,25 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/BitPonyLLC/huekeys/internal/image_matcher"
 	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
 	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
 
 	"github.com/spf13/cobra"
 )
 
 var getCmd = &cobra.Command{
-	Use:   "get",
-	Short: "Gets the color and brightness of the keyboard",
+	Use:   "get [picture...]",
+	Short: "Gets the color and brightness of the keyboard (and the dominant color of any pictures)",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if showPalette {
+			return printPalettes(cmd, args)
+		}
+
 		pattern := patterns.GetRunning()
 		if pattern == nil {
 			if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
@@ -19,6 +27,9 @@ var getCmd = &cobra.Command{
 			}
 		} else {
 			cmd.Println("running =", pattern)
+			if idlePattern := pattern.GetBase().IdlePattern(); idlePattern != nil {
+				cmd.Println("idle =", idlePattern)
+			}
 		}
 
 		brightness, err := keyboard.GetCurrentBrightness()
@@ -38,7 +49,7 @@ var getCmd = &cobra.Command{
 		}
 
 		for _, arg := range args {
-			color, err := image_matcher.GetDominantColorOf(arg)
+			color, err := image_matcher.GetDominantColorOf(arg, matchOptions())
 			if err != nil {
 				return fail(13, "can't determine dominant color of %s: %w", arg, err)
 			}
@@ -49,6 +60,51 @@ var getCmd = &cobra.Command{
 	},
 }
 
+var showPalette bool
+
 func init() {
+	getCmd.Flags().BoolVar(&showPalette, "palette", false, "print all the colors extracted from the pictures instead")
 	rootCmd.AddCommand(getCmd)
 }
+
+// printPalettes shows the colors of each picture, from the one chosen as the
+// dominant color (according to the desktop pattern's configuration) to the
+// least fitting.
+func printPalettes(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fail(13, "at least one picture is required for the palette")
+	}
+
+	swatches := util.IsTTY(os.Stdout)
+	for _, arg := range args {
+		palette, err := image_matcher.GetPaletteOf(arg, matchOptions())
+		if err != nil {
+			return fail(13, "can't determine palette of %s: %w", arg, err)
+		}
+
+		cmd.Printf("%s:\n", arg)
+		for i, s := range palette {
+			swatch := ""
+			if swatches {
+				r, g, b := s.RGB()
+				swatch = fmt.Sprintf("\x1b[38;2;%d;%d;%dm████\x1b[0m ", r, g, b)
+			}
+
+			note := ""
+			if i == 0 {
+				note = " (dominant)"
+			} else if s.Excluded {
+				note = " (excluded)"
+			}
+
+			cmd.Printf("  %s%s %5.1f%%  saturation=%.2f value=%.2f score=%.3f%s\n",
+				swatch, s.Color, s.Share*100, s.Saturation, s.Value, s.Score, note)
+		}
+	}
+
+	return nil
+}
+
+func matchOptions() *image_matcher.Options {
+	return patterns.Get("desktop").(*patterns.DesktopPattern).MatchOptions()
+}
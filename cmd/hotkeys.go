@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/BitPonyLLC/huekeys/pkg/hotkeys"
+	"github.com/BitPonyLLC/huekeys/pkg/input"
+	"github.com/BitPonyLLC/huekeys/pkg/ipc"
+	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// defaultHotkeys are the chords bound unless otherwise configured.
+func defaultHotkeys() map[string]string {
+	return map[string]string{
+		"ctrl+alt+f9":  "cycle",
+		"ctrl+alt+f10": "set -- -32",
+		"ctrl+alt+f11": "set -- +32",
+		"ctrl+alt+f12": "toggle",
+	}
+}
+
+// startHotkeys will watch for configured chords in the background, sending
+// each bound command to our own IPC server as if from a remote client.
+func startHotkeys(ctx context.Context) error {
+	if !viper.GetBool("hotkeys.enabled") {
+		return nil
+	}
+
+	hk, err := hotkeys.New(viper.GetStringMapString("hotkeys.bindings"))
+	if err != nil {
+		return err
+	}
+
+	if hk.Len() == 0 {
+		log.Warn().Msg("hotkeys enabled without any bindings")
+		return nil
+	}
+
+	selects, err := keyboardSelector()
+	if err != nil {
+		return err
+	}
+
+	hlog := log.With().Str("module", "hotkeys").Logger()
+	return hk.Watch(ctx, &hlog, selects, func(command string) {
+		// don't hold up reading the keyboard while the command is processed
+		go func() {
+			resp, err := ipc.Send(waitSockPath(), command)
+			if err != nil {
+				hlog.Err(err).Str("cmd", command).Msg("can't dispatch hotkey")
+				return
+			}
+
+			resp = strings.TrimSpace(resp)
+			if resp != "" {
+				hlog.Debug().Str("cmd", command).Str("resp", resp).Msg("dispatched")
+			}
+		}()
+	})
+}
+
+// keyboardSelector chooses the same keyboards as the typing pattern.
+func keyboardSelector() (input.Selector, error) {
+	specs := viper.GetStringSlice("typing." + patterns.DevicesLabel)
+	specs = append(specs, viper.GetString("typing."+patterns.InputEventIDLabel))
+	return input.NewSelector(specs...)
+}
+
+func init() {
+	viper.SetDefault("hotkeys.bindings", defaultHotkeys())
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/BitPonyLLC/huekeys/pkg/idle"
+	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// startIdle will turn the keyboard off in the background while no input is
+// received, pausing whatever pattern is running.
+func startIdle(ctx context.Context) error {
+	timeout := viper.GetDuration("idle.timeout")
+	if timeout <= 0 {
+		return nil
+	}
+
+	selects, err := patterns.ActivitySelector()
+	if err != nil {
+		return err
+	}
+
+	dimmer := idle.New(timeout, viper.GetDuration("idle.fade"))
+	dimmer.OnSleep = patterns.Pause
+	dimmer.OnWake = patterns.Resume
+
+	ilog := log.With().Str("module", "idle").Logger()
+	return dimmer.Watch(ctx, &ilog, selects)
+}
+
+func init() {
+	viper.SetDefault("idle.fade", idle.DefaultFade)
+	viper.SetDefault("idle.devices", []string{"(?i)touchpad|mouse|trackpoint"})
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/BitPonyLLC/huekeys/pkg/locks"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// startLocks will show the state of the lock keys in the background.
+func startLocks(ctx context.Context) error {
+	if !viper.GetBool("locks.enabled") {
+		return nil
+	}
+
+	colors := map[string]string{}
+	for _, lock := range locks.Order {
+		colors[lock] = viper.GetString("locks." + lock)
+	}
+
+	ind, err := locks.New(colors, viper.GetString("locks.zone"))
+	if err != nil {
+		return err
+	}
+
+	if ind.Len() == 0 {
+		log.Warn().Msg("locks enabled without any colors")
+		return nil
+	}
+
+	selects, err := keyboardSelector()
+	if err != nil {
+		return err
+	}
+
+	llog := log.With().Str("module", "locks").Logger()
+	return ind.Watch(ctx, &llog, selects)
+}
+
+func init() {
+	viper.SetDefault("locks."+locks.CapsLock, "red")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/notify"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Temporarily shows an alert over any running pattern and then restores it",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
+			return sendViaIPC(cmd)
+		}
+
+		n := &notify.Notification{
+			Color:    viper.GetString("notify.color"),
+			Count:    viper.GetInt("notify.count"),
+			Style:    viper.GetString("notify.style"),
+			Priority: viper.GetInt("notify.priority"),
+			Delay:    viper.GetDuration("notify.delay"),
+		}
+
+		if waitPidPath.IsOurs() {
+			// fire-and-forget: let the client go while the queue is processed
+			return notify.Enqueue(cmd.Context(), &log.Logger, n)
+		}
+
+		return notify.Play(cmd.Context(), n)
+	},
+}
+
+func init() {
+	notifyCmd.Flags().StringP("color", "c", "red", "the color of the alert")
+	viper.BindPFlag("notify.color", notifyCmd.Flags().Lookup("color"))
+
+	notifyCmd.Flags().IntP("count", "n", 3, "the number of times to blink or pulse")
+	viper.BindPFlag("notify.count", notifyCmd.Flags().Lookup("count"))
+
+	notifyCmd.Flags().StringP("style", "s", notify.BlinkStyle, "how to show the alert: blink or pulse")
+	viper.BindPFlag("notify.style", notifyCmd.Flags().Lookup("style"))
+
+	notifyCmd.Flags().IntP("priority", "p", 0, "alerts with higher priority are shown before others waiting in the queue")
+	viper.BindPFlag("notify.priority", notifyCmd.Flags().Lookup("priority"))
+
+	notifyCmd.Flags().DurationP("delay", "d", 250*time.Millisecond, "the amount of time the alert stays on (and off) for each blink or pulse")
+	viper.BindPFlag("notify.delay", notifyCmd.Flags().Lookup("delay"))
+
+	rootCmd.AddCommand(notifyCmd)
+}
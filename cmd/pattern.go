@@ -3,8 +3,12 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/BitPonyLLC/huekeys/buildinfo"
+	"github.com/BitPonyLLC/huekeys/internal/desktop"
+	"github.com/BitPonyLLC/huekeys/internal/image_matcher"
 	"github.com/BitPonyLLC/huekeys/pkg/patterns"
 	"github.com/BitPonyLLC/huekeys/pkg/pidpath"
 	"github.com/BitPonyLLC/huekeys/pkg/util"
@@ -30,8 +34,246 @@ func init() {
 	addPatternCmd("pulse the keyboard brightness up and down", patterns.Get("pulse"))
 	addPatternCmd("loop through all the colors of the rainbow", patterns.Get("rainbow"))
 	addPatternCmd("constantly change the color to a random selection", patterns.Get("random"))
-	addPatternCmd("change the color according to CPU utilization (cold to hot)", patterns.Get("cpu"))
-	addPatternCmd("monitor the desktop picture and change the keyboard color to match", patterns.Get("desktop"))
+	cpuPattern := patterns.Get("cpu")
+	addGradientFlags(addPatternCmd("change the color according to CPU utilization (cold to hot)", cpuPattern), cpuPattern)
+	desktopPattern := patterns.Get("desktop")
+	desktopCmd := addPatternCmd("monitor the desktop picture and change the keyboard color to match", desktopPattern)
+	desktopCmd.Flags().String(patterns.SourceLabel, "", "where to find the desktop picture: "+strings.Join(desktop.Names(), ", ")+" (default according to the current desktop)")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.SourceLabel, desktopCmd.Flags().Lookup(patterns.SourceLabel))
+	desktopCmd.Flags().String(patterns.ModeLabel, patterns.DominantMode, "how the colors of the picture are shown: "+strings.Join(patterns.DesktopModes, ", "))
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.ModeLabel, desktopCmd.Flags().Lookup(patterns.ModeLabel))
+	desktopCmd.Flags().Int(patterns.ColorsLabel, patterns.DefaultDesktopColors, "the number of top colors cycled through or spread across zones")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.ColorsLabel, desktopCmd.Flags().Lookup(patterns.ColorsLabel))
+	desktopCmd.Flags().Duration(patterns.CyclePeriodLabel, patterns.DefaultCyclePeriod, "how long each color is shown when cycling")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.CyclePeriodLabel, desktopCmd.Flags().Lookup(patterns.CyclePeriodLabel))
+	desktopCmd.Flags().Duration(patterns.CrossfadeLabel, patterns.DefaultCrossfade, "how long it takes to fade to the next color when cycling")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.CrossfadeLabel, desktopCmd.Flags().Lookup(patterns.CrossfadeLabel))
+	desktopCmd.Flags().String(patterns.StrategyLabel, image_matcher.DefaultStrategy, "how the dominant color is chosen: "+strings.Join(image_matcher.Strategies, ", "))
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.StrategyLabel, desktopCmd.Flags().Lookup(patterns.StrategyLabel))
+	desktopCmd.Flags().Int(patterns.ClustersLabel, image_matcher.DefaultClusters, "the number of colors (k) extracted from the picture")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.ClustersLabel, desktopCmd.Flags().Lookup(patterns.ClustersLabel))
+	desktopCmd.Flags().Float64(patterns.MinSaturationLabel, image_matcher.DefaultMinSaturation, "the lowest saturation (0.0 - 1.0) chosen by the saturated strategy")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.MinSaturationLabel, desktopCmd.Flags().Lookup(patterns.MinSaturationLabel))
+	desktopCmd.Flags().Bool(patterns.ExcludeExtremesLabel, true, "avoid near-black and near-white colors")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.ExcludeExtremesLabel, desktopCmd.Flags().Lookup(patterns.ExcludeExtremesLabel))
+	desktopCmd.Flags().Bool(patterns.CenterWeightedLabel, false, "count colors toward the center of the picture more")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.CenterWeightedLabel, desktopCmd.Flags().Lookup(patterns.CenterWeightedLabel))
+	desktopCmd.Flags().String(patterns.CacheLabel, defaultCacheDir(), "where the colors extracted from pictures are kept (none are kept when empty)")
+	viper.BindPFlag(desktopPattern.GetBase().Name+"."+patterns.CacheLabel, desktopCmd.Flags().Lookup(patterns.CacheLabel))
+	desktopCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := rejectRemoteFlags(cmd, patterns.CacheLabel); err != nil {
+			return err
+		}
+		return commonPreRunE(cmd, args)
+	}
+
+	slideshowPattern := patterns.Get("slideshow")
+	slideshowCmd := addPatternCmd("change the color to match each picture in a directory in turn", slideshowPattern)
+	slideshowCmd.Flags().String(patterns.DirectoryLabel, "", "the directory of pictures to show")
+	viper.BindPFlag(slideshowPattern.GetBase().Name+"."+patterns.DirectoryLabel, slideshowCmd.Flags().Lookup(patterns.DirectoryLabel))
+	slideshowCmd.Flags().Bool(patterns.ShuffleLabel, false, "show the pictures in a random order instead of by name")
+	viper.BindPFlag(slideshowPattern.GetBase().Name+"."+patterns.ShuffleLabel, slideshowCmd.Flags().Lookup(patterns.ShuffleLabel))
+
+	themePattern := patterns.Get("theme")
+	themeLabel := themePattern.GetBase().Name + "."
+	themeCmd := addPatternCmd("follow the desktop accent color and light or dark style", themePattern)
+	themeCmd.Flags().String(patterns.SourceLabel, "", "where to find the desktop theme: "+strings.Join(desktop.ThemeNames(), ", ")+" (default according to the current desktop)")
+	viper.BindPFlag(themeLabel+patterns.SourceLabel, themeCmd.Flags().Lookup(patterns.SourceLabel))
+	themeCmd.Flags().String(patterns.LightColorLabel, "", "the color used when the desktop is light (default the accent color)")
+	viper.BindPFlag(themeLabel+patterns.LightColorLabel, themeCmd.Flags().Lookup(patterns.LightColorLabel))
+	themeCmd.Flags().String(patterns.DarkColorLabel, "", "the color used when the desktop is dark (default the accent color)")
+	viper.BindPFlag(themeLabel+patterns.DarkColorLabel, themeCmd.Flags().Lookup(patterns.DarkColorLabel))
+	themeCmd.Flags().Int(patterns.LightBrightnessLabel, patterns.DefaultLightBrightness, "the brightness used when the desktop is light (unchanged when negative)")
+	viper.BindPFlag(themeLabel+patterns.LightBrightnessLabel, themeCmd.Flags().Lookup(patterns.LightBrightnessLabel))
+	themeCmd.Flags().Int(patterns.DarkBrightnessLabel, patterns.DefaultDarkBrightness, "the brightness used when the desktop is dark (unchanged when negative)")
+	viper.BindPFlag(themeLabel+patterns.DarkBrightnessLabel, themeCmd.Flags().Lookup(patterns.DarkBrightnessLabel))
+	themeCmd.Flags().String(patterns.FallbackColorLabel, patterns.DefaultFallbackColor, "the color used when the desktop has no accent color")
+	viper.BindPFlag(themeLabel+patterns.FallbackColorLabel, themeCmd.Flags().Lookup(patterns.FallbackColorLabel))
+
+	//----------------------------------------
+	rulesPattern := patterns.Get("rules")
+	rulesCmd := addPatternCmd("change the color according to configured rules about system metrics", rulesPattern)
+	rulesCmd.Flags().Duration(patterns.FlashDelayLabel, patterns.DefaultFlashDelay, "the amount of time between toggles of a flashing rule")
+	viper.BindPFlag(rulesPattern.GetBase().Name+"."+patterns.FlashDelayLabel, rulesCmd.Flags().Lookup(patterns.FlashDelayLabel))
+
+	//----------------------------------------
+	execPattern := patterns.Get("exec")
+	execLabel := execPattern.GetBase().Name + "."
+
+	execCmd := addPatternCmd("change the color according to the output of a command", execPattern)
+	execCmd.Use += " [-- command [args...]]"
+	execCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			// keep each argument whole when run by the shell
+			quoted := make([]string, len(args))
+			for i, arg := range args {
+				quoted[i] = shellQuote(arg)
+			}
+			if err := cmd.Flags().Set(patterns.CommandLabel, strings.Join(quoted, " ")); err != nil {
+				return err
+			}
+		}
+		return commonPreRunE(cmd, args)
+	}
+
+	execCmd.Flags().StringP(patterns.CommandLabel, "c", "", "the command to run (each line printed may contain colors, brightness values, or zone=color)")
+	viper.BindPFlag(execLabel+patterns.CommandLabel, execCmd.Flags().Lookup(patterns.CommandLabel))
+
+	//----------------------------------------
+	logwatchPattern := patterns.Get("logwatch")
+	logwatchLabel := logwatchPattern.GetBase().Name + "."
+
+	logwatchCmd := addPatternCmd("flash or change the color when lines matching a regex are written to log files", logwatchPattern)
+	logwatchCmd.Use += " [file...]"
+	logwatchCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		for _, arg := range args {
+			// the background process doesn't share our working directory
+			path, err := filepath.Abs(arg)
+			if err != nil {
+				return err
+			}
+			if err = cmd.Flags().Set(patterns.FilesLabel, path); err != nil {
+				return err
+			}
+		}
+		return commonPreRunE(cmd, args)
+	}
+
+	logwatchCmd.Flags().StringSliceP(patterns.FilesLabel, "f", nil, "the files to watch")
+	viper.BindPFlag(logwatchLabel+patterns.FilesLabel, logwatchCmd.Flags().Lookup(patterns.FilesLabel))
+
+	logwatchCmd.Flags().StringArrayP(patterns.MatchLabel, "m", nil, "a regex and the color of the alert raised when a line matches it (e.g. 'ERROR=red')")
+	viper.BindPFlag(logwatchLabel+patterns.MatchLabel, logwatchCmd.Flags().Lookup(patterns.MatchLabel))
+
+	logwatchCmd.Flags().StringP(patterns.BaseLabel, "b", "", "name of pattern to run while there is no alert")
+	viper.BindPFlag(logwatchLabel+patterns.BaseLabel, logwatchCmd.Flags().Lookup(patterns.BaseLabel))
+
+	logwatchCmd.Flags().Bool(patterns.FlashLabel, false, "flash all alerts instead of showing a solid color")
+	viper.BindPFlag(logwatchLabel+patterns.FlashLabel, logwatchCmd.Flags().Lookup(patterns.FlashLabel))
+
+	logwatchCmd.Flags().Duration(patterns.FlashDelayLabel, patterns.DefaultFlashDelay, "the amount of time between toggles of a flashing alert")
+	viper.BindPFlag(logwatchLabel+patterns.FlashDelayLabel, logwatchCmd.Flags().Lookup(patterns.FlashDelayLabel))
+
+	//----------------------------------------
+	reactivePattern := patterns.Get("reactive")
+	reactiveLabel := reactivePattern.GetBase().Name + "."
+
+	reactiveCmd := addPatternCmd("light up the keyboard (or its zones) for every key pressed", reactivePattern)
+
+	reactiveCmd.Flags().String(patterns.EffectLabel, patterns.ColorEffect, "what changes for each key press: color or brightness")
+	viper.BindPFlag(reactiveLabel+patterns.EffectLabel, reactiveCmd.Flags().Lookup(patterns.EffectLabel))
+
+	reactiveCmd.Flags().StringP(patterns.ColorLabel, "c", "blue", "the color shown between key presses")
+	viper.BindPFlag(reactiveLabel+patterns.ColorLabel, reactiveCmd.Flags().Lookup(patterns.ColorLabel))
+
+	reactiveCmd.Flags().StringP(patterns.KeyColorLabel, "k", "white", "the color shown for a key press")
+	viper.BindPFlag(reactiveLabel+patterns.KeyColorLabel, reactiveCmd.Flags().Lookup(patterns.KeyColorLabel))
+
+	reactiveCmd.Flags().Duration(patterns.DecayLabel, patterns.DefaultDecay, "the amount of time a key press takes to fade away")
+	viper.BindPFlag(reactiveLabel+patterns.DecayLabel, reactiveCmd.Flags().Lookup(patterns.DecayLabel))
+
+	reactiveCmd.Flags().Bool(patterns.RippleLabel, false, "spread each key press outward to the neighboring zones")
+	viper.BindPFlag(reactiveLabel+patterns.RippleLabel, reactiveCmd.Flags().Lookup(patterns.RippleLabel))
+
+	//----------------------------------------
+	wavePattern := patterns.Get("wave")
+	waveLabel := wavePattern.GetBase().Name + "."
+
+	waveCmd := addPatternCmd("smoothly change the brightness, hue, or saturation along a waveform", wavePattern)
+
+	waveCmd.Flags().String(patterns.ShapeLabel, "sine", "the shape of the waveform: "+strings.Join(patterns.WaveShapes, ", ")+", or cubic-bezier(x1,y1,x2,y2)")
+	viper.BindPFlag(waveLabel+patterns.ShapeLabel, waveCmd.Flags().Lookup(patterns.ShapeLabel))
+
+	waveCmd.Flags().Duration(patterns.PeriodLabel, 4*time.Second, "the amount of time for one full cycle of the waveform")
+	viper.BindPFlag(waveLabel+patterns.PeriodLabel, waveCmd.Flags().Lookup(patterns.PeriodLabel))
+
+	waveCmd.Flags().Float64(patterns.MinLabel, 0, "the lowest level of the waveform (0.0 to 1.0)")
+	viper.BindPFlag(waveLabel+patterns.MinLabel, waveCmd.Flags().Lookup(patterns.MinLabel))
+
+	waveCmd.Flags().Float64(patterns.MaxLabel, 1, "the highest level of the waveform (0.0 to 1.0)")
+	viper.BindPFlag(waveLabel+patterns.MaxLabel, waveCmd.Flags().Lookup(patterns.MaxLabel))
+
+	waveCmd.Flags().String(patterns.TargetLabel, patterns.BrightnessTarget, "what the waveform changes: brightness, hue, or saturation")
+	viper.BindPFlag(waveLabel+patterns.TargetLabel, waveCmd.Flags().Lookup(patterns.TargetLabel))
+
+	waveCmd.Flags().String(patterns.ColorLabel, "blue", "the color modulated when targeting hue or saturation")
+	viper.BindPFlag(waveLabel+patterns.ColorLabel, waveCmd.Flags().Lookup(patterns.ColorLabel))
+
+	//----------------------------------------
+	morsePattern := patterns.Get("morse")
+	morseLabel := morsePattern.GetBase().Name + "."
+
+	morseCmd := addPatternCmd("blink a message in morse code", morsePattern)
+	morseCmd.Use += " [message]"
+	morseCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			if err := cmd.Flags().Set(patterns.MessageLabel, strings.Join(args, " ")); err != nil {
+				return err
+			}
+		}
+		return commonPreRunE(cmd, args)
+	}
+
+	morseCmd.Flags().StringP(patterns.MessageLabel, "m", "", "the message to blink")
+	viper.BindPFlag(morseLabel+patterns.MessageLabel, morseCmd.Flags().Lookup(patterns.MessageLabel))
+
+	morseCmd.Flags().Bool(patterns.LoopLabel, true, "keep repeating the message")
+	viper.BindPFlag(morseLabel+patterns.LoopLabel, morseCmd.Flags().Lookup(patterns.LoopLabel))
+
+	morseCmd.Flags().String(patterns.ModeLabel, patterns.BrightnessMode, "blink using the keyboard brightness or color")
+	viper.BindPFlag(morseLabel+patterns.ModeLabel, morseCmd.Flags().Lookup(patterns.ModeLabel))
+
+	morseCmd.Flags().String(patterns.ColorLabel, "white", "the \"on\" color when blinking with color")
+	viper.BindPFlag(morseLabel+patterns.ColorLabel, morseCmd.Flags().Lookup(patterns.ColorLabel))
+
+	morseCmd.Flags().String(patterns.OffColorLabel, "000000", "the \"off\" color when blinking with color")
+	viper.BindPFlag(morseLabel+patterns.OffColorLabel, morseCmd.Flags().Lookup(patterns.OffColorLabel))
+
+	//----------------------------------------
+	timerPattern := patterns.Get("timer")
+	timerLabel := timerPattern.GetBase().Name + "."
+
+	timerRunCmd := addPatternCmd("count down a duration by sweeping colors, optionally cycling pomodoro periods", timerPattern)
+	timerRunCmd.Use += " [duration]"
+	timerRunCmd.Args = cobra.MaximumNArgs(1)
+	timerRunCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			if err := cmd.Flags().Set(patterns.DurationLabel, args[0]); err != nil {
+				return err
+			}
+		}
+		return commonPreRunE(cmd, args)
+	}
+
+	timerRunCmd.Flags().Duration(patterns.DurationLabel, 25*time.Minute, "the amount of time to count down")
+	viper.BindPFlag(timerLabel+patterns.DurationLabel, timerRunCmd.Flags().Lookup(patterns.DurationLabel))
+
+	timerRunCmd.Flags().String(patterns.FromColorLabel, "green", "the color shown when the countdown begins")
+	viper.BindPFlag(timerLabel+patterns.FromColorLabel, timerRunCmd.Flags().Lookup(patterns.FromColorLabel))
+
+	timerRunCmd.Flags().String(patterns.ToColorLabel, "red", "the color shown (and flashed) when the countdown expires")
+	viper.BindPFlag(timerLabel+patterns.ToColorLabel, timerRunCmd.Flags().Lookup(patterns.ToColorLabel))
+
+	timerRunCmd.Flags().String(patterns.BreakColorLabel, "blue", "the color shown when a pomodoro break begins")
+	viper.BindPFlag(timerLabel+patterns.BreakColorLabel, timerRunCmd.Flags().Lookup(patterns.BreakColorLabel))
+
+	timerRunCmd.Flags().Bool(patterns.DimLabel, false, "dim the brightness instead of sweeping the colors")
+	viper.BindPFlag(timerLabel+patterns.DimLabel, timerRunCmd.Flags().Lookup(patterns.DimLabel))
+
+	timerRunCmd.Flags().Bool(patterns.PomodoroLabel, false, "cycle through pomodoro work and break periods")
+	viper.BindPFlag(timerLabel+patterns.PomodoroLabel, timerRunCmd.Flags().Lookup(patterns.PomodoroLabel))
+
+	timerRunCmd.Flags().Duration(patterns.WorkLabel, 25*time.Minute, "the length of pomodoro work periods")
+	viper.BindPFlag(timerLabel+patterns.WorkLabel, timerRunCmd.Flags().Lookup(patterns.WorkLabel))
+
+	timerRunCmd.Flags().Duration(patterns.ShortBreakLabel, 5*time.Minute, "the length of pomodoro short breaks")
+	viper.BindPFlag(timerLabel+patterns.ShortBreakLabel, timerRunCmd.Flags().Lookup(patterns.ShortBreakLabel))
+
+	timerRunCmd.Flags().Duration(patterns.LongBreakLabel, 15*time.Minute, "the length of pomodoro long breaks")
+	viper.BindPFlag(timerLabel+patterns.LongBreakLabel, timerRunCmd.Flags().Lookup(patterns.LongBreakLabel))
+
+	timerRunCmd.Flags().Int(patterns.LongBreakEveryLabel, 4, "the number of pomodoro work periods before a long break")
+	viper.BindPFlag(timerLabel+patterns.LongBreakEveryLabel, timerRunCmd.Flags().Lookup(patterns.LongBreakEveryLabel))
 
 	//----------------------------------------
 	desktopEnv := ""
@@ -50,7 +292,16 @@ func init() {
 				return err
 			}
 		}
-		return ipcServer.Start(cmd.Context(), &log.Logger, waitSockPath(), rootCmd)
+		if err := ipcServer.Start(cmd.Context(), &log.Logger, waitSockPath(), rootCmd); err != nil {
+			return err
+		}
+		if err := startHotkeys(cmd.Context()); err != nil {
+			return err
+		}
+		if err := startLocks(cmd.Context()); err != nil {
+			return err
+		}
+		return startIdle(cmd.Context())
 	}
 	waitCmd.PostRun = func(cmd *cobra.Command, args []string) {
 		if waitPidPath != nil {
@@ -69,12 +320,21 @@ func init() {
 	waitCmd.Flags().Duration(patterns.MonitorLabel, 0, "monitor and preserve set color and/or brightness")
 	viper.BindPFlag("wait."+patterns.MonitorLabel, waitCmd.Flags().Lookup(patterns.MonitorLabel))
 
-	waitCmd.Flags().StringVar(&desktopEnv, "env", desktopEnv, "environment to set for desktop pattern")
+	waitCmd.Flags().Bool("hotkeys", false, "watch the keyboard for hotkeys (see the hotkeys.bindings configuration)")
+	viper.BindPFlag("hotkeys.enabled", waitCmd.Flags().Lookup("hotkeys"))
+
+	waitCmd.Flags().Bool("locks", false, "tint the keyboard while caps, num, or scroll lock is on (see the locks configuration)")
+	viper.BindPFlag("locks.enabled", waitCmd.Flags().Lookup("locks"))
+
+	waitCmd.Flags().Duration("idle", 0, "turn the keyboard off after this long without any input (see the idle configuration)")
+	viper.BindPFlag("idle.timeout", waitCmd.Flags().Lookup("idle"))
+
+	waitCmd.Flags().StringVar(&desktopEnv, "env", desktopEnv, "environment to set for the desktop and theme patterns")
 	waitCmd.Flags().MarkHidden("env") // only used by menu
 
 	//----------------------------------------
 	watchPattern := patterns.Get("watch").(*patterns.WatchPattern)
-	watchCmd := addPatternCmd("watch and report color, brightness, and pattern changes", watchPattern)
+	watchCmd := addPatternCmd("watch and report color, brightness, pattern, idle pattern, and typing speed changes", watchPattern)
 	// watch needs to behave differently from others when run...
 	watchCmd.RunE = func(cmd *cobra.Command, _ []string) error {
 		if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
@@ -93,18 +353,48 @@ func init() {
 	typingLabel := typingPattern.GetBase().Name + "."
 
 	typeCmd := addPatternCmd("change the color according to typing speed (cold to hot)", typingPattern)
+	addGradientFlags(typeCmd, typingPattern)
 
-	typeCmd.Flags().String(patterns.InputEventIDLabel, "", "input event ID to monitor")
+	typeCmd.Flags().String(patterns.InputEventIDLabel, "", "input event ID to monitor (in addition to any devices)")
 	viper.BindPFlag(typingLabel+patterns.InputEventIDLabel, typeCmd.Flags().Lookup(patterns.InputEventIDLabel))
 
+	typeCmd.Flags().StringSlice(patterns.DevicesLabel, nil, "input devices to monitor: event IDs, paths (e.g. /dev/input/by-id/...), or regular expressions matching device names (default all keyboards)")
+	viper.BindPFlag(typingLabel+patterns.DevicesLabel, typeCmd.Flags().Lookup(patterns.DevicesLabel))
+
 	typeCmd.Flags().Bool(patterns.AllKeysLabel, false, "count any key pressed instead of only those that are considered \"printable\"")
 	viper.BindPFlag(typingLabel+patterns.AllKeysLabel, typeCmd.Flags().Lookup(patterns.AllKeysLabel))
 
-	typeCmd.Flags().StringP(patterns.IdleLabel, "i", "", "name of pattern to run while keyboard is idle for more than the idle period")
-	viper.BindPFlag(typingLabel+patterns.IdleLabel, typeCmd.Flags().Lookup(patterns.IdleLabel))
+	typeCmd.Flags().String(patterns.MetricLabel, patterns.SpeedMetric, "what chooses the color: "+strings.Join(patterns.TypingMetrics, ", "))
+	viper.BindPFlag(typingLabel+patterns.MetricLabel, typeCmd.Flags().Lookup(patterns.MetricLabel))
 
-	typeCmd.Flags().DurationP(patterns.IdlePeriodLabel, "p", patterns.DefaultIdlePeriod, "amount of idle time to wait before starting the idle pattern")
-	viper.BindPFlag(typingLabel+patterns.IdlePeriodLabel, typeCmd.Flags().Lookup(patterns.IdlePeriodLabel))
+	typeCmd.Flags().Duration(patterns.AccuracyWindowLabel, patterns.DefaultAccuracyWindow, "amount of recent typing used to measure accuracy")
+	viper.BindPFlag(typingLabel+patterns.AccuracyWindowLabel, typeCmd.Flags().Lookup(patterns.AccuracyWindowLabel))
+
+	typeCmd.Flags().Float64(patterns.MaxErrorRatioLabel, patterns.DefaultMaxErrorRatio, "ratio of corrections (backspace or delete) to printable keys that shows the hottest color")
+	viper.BindPFlag(typingLabel+patterns.MaxErrorRatioLabel, typeCmd.Flags().Lookup(patterns.MaxErrorRatioLabel))
+
+	typeCmd.Flags().String(patterns.StatsPathLabel, "", "file within your home directory to persist daily typing totals (e.g. ~/.local/share/huekeys/typing.json)")
+	viper.BindPFlag(typingLabel+patterns.StatsPathLabel, typeCmd.Flags().Lookup(patterns.StatsPathLabel))
+	typeCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := rejectRemoteFlags(cmd, patterns.StatsPathLabel); err != nil {
+			return err
+		}
+		return commonPreRunE(cmd, args)
+	}
+
+	//----------------------------------------
+	scripts, err := patterns.LoadScripts(scriptsDir())
+	if err != nil {
+		log.Warn().Err(err).Msg("can't load scripts")
+	}
+
+	for _, script := range scripts {
+		short := script.Description
+		if short == "" {
+			short = "run the " + script.Name + " script"
+		}
+		addPatternCmd(short, script)
+	}
 }
 
 func addPatternCmd(short string, pattern patterns.Pattern) *cobra.Command {
@@ -118,6 +408,12 @@ func addPatternCmd(short string, pattern patterns.Pattern) *cobra.Command {
 			if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
 				return sendViaIPC(cmd)
 			}
+
+			idle := viper.GetString(basePattern.Name + "." + patterns.IdleLabel)
+			if err := requireInvokingPeer(cmd, basePattern.Name, idle); err != nil {
+				return err
+			}
+
 			return pattern.Run(cmd.Context(), &log.Logger)
 		},
 	}
@@ -129,14 +425,61 @@ func addPatternCmd(short string, pattern patterns.Pattern) *cobra.Command {
 		viper.BindPFlag(basePattern.Name+".delay", cmd.Flags().Lookup("delay"))
 	}
 
+	if basePattern.SupportsIdle() {
+		cmd.Flags().StringP(patterns.IdleLabel, "i", "", "name of pattern to run while there is no input for more than the idle period")
+		viper.BindPFlag(basePattern.Name+"."+patterns.IdleLabel, cmd.Flags().Lookup(patterns.IdleLabel))
+
+		cmd.Flags().DurationP(patterns.IdlePeriodLabel, "p", patterns.DefaultIdlePeriod, "amount of time without input to wait before starting the idle pattern")
+		viper.BindPFlag(basePattern.Name+"."+patterns.IdlePeriodLabel, cmd.Flags().Lookup(patterns.IdlePeriodLabel))
+	}
+
 	runCmd.AddCommand(cmd)
 	return cmd
 }
 
+func addGradientFlags(cmd *cobra.Command, pattern patterns.Pattern) {
+	label := pattern.GetBase().Name + "."
+
+	cmd.Flags().String(patterns.GradientLabel, patterns.DefaultGradient,
+		"name of the gradient to use ("+strings.Join(patterns.GradientNames(), ", ")+") or a comma separated list of colors")
+	viper.BindPFlag(label+patterns.GradientLabel, cmd.Flags().Lookup(patterns.GradientLabel))
+
+	cmd.Flags().Int(patterns.StepsLabel, patterns.DefaultGradientSteps, "number of colors to interpolate from the gradient")
+	viper.BindPFlag(label+patterns.StepsLabel, cmd.Flags().Lookup(patterns.StepsLabel))
+}
+
 func commonPreRunE(cmd *cobra.Command, _ []string) error {
 	return util.BeNice(viper.GetInt("nice"))
 }
 
+// scriptsDir returns the directory where the invoking user keeps scripted
+// patterns (e.g. ~/.config/huekeys/patterns).
+func scriptsDir() string {
+	home := ""
+	if u, err := util.InvokingUser(); err == nil {
+		home = u.HomeDir
+	} else {
+		home, _ = os.UserHomeDir()
+	}
+
+	return filepath.Join(home, ".config", buildinfo.App.Name, "patterns")
+}
+
+// defaultCacheDir returns where the colors extracted from pictures are kept
+// (e.g. ~/.cache/huekeys), keeping root's cache out of the invoking user's home.
+func defaultCacheDir() string {
+	if os.Getuid() == 0 {
+		return patterns.RootCacheDir
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, buildinfo.App.Name)
+}
+
 func waitSockPath() string {
 	return viper.GetString("wait.sockpath")
 }
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/BitPonyLLC/huekeys/pkg/ipc"
+	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -20,7 +24,11 @@ func sendMsgViaIPC(cmd *cobra.Command, msg string) error {
 
 func sendViaIPCForeground(cmd *cobra.Command, foreground bool, msg string) error {
 	if msg == "" {
-		msg = strings.Join(os.Args[1:], " ")
+		args := make([]string, len(os.Args)-1)
+		for i, arg := range os.Args[1:] {
+			args[i] = shellQuote(arg)
+		}
+		msg = strings.Join(args, " ")
 	}
 
 	log.Debug().Int("pid", waitPidPath.Getpid()).Str("cmd", msg).Msg("sending")
@@ -47,3 +55,70 @@ func sendViaIPCForeground(cmd *cobra.Command, foreground bool, msg string) error
 
 	return nil
 }
+
+// shellQuote protects an argument so the IPC server splits it back out exactly as
+// provided (e.g. a command to run containing spaces, pipes, or semicolons).
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, needsQuoting) < 0 {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func needsQuoting(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_=+.,:/@%", r))
+}
+
+// rejectRemoteFlags fails if any of the named flags were provided with a
+// command received over IPC. The socket is open to every local user, so flags
+// naming files that would be written as root are only accepted from the
+// configuration. The flags are reset so their values are never used.
+func rejectRemoteFlags(cmd *cobra.Command, names ...string) error {
+	if ipc.PeerFrom(cmd.Context()) == nil {
+		return nil
+	}
+
+	for _, name := range names {
+		f := cmd.Flags().Lookup(name)
+		if f == nil || !f.Changed {
+			continue
+		}
+
+		f.Value.Set(f.DefValue)
+		f.Changed = false
+
+		return fmt.Errorf("--%s can't be sent to a running daemon: set it in the configuration instead", name)
+	}
+
+	return nil
+}
+
+// requireInvokingPeer fails if any of the patterns run the invoking user's
+// commands or scripts and the command was received over IPC from another user.
+// The socket is open to every local user, who would otherwise be able to run
+// code as the invoking user.
+func requireInvokingPeer(cmd *cobra.Command, names ...string) error {
+	peer := ipc.PeerFrom(cmd.Context())
+	if peer == nil || peer.Uid == 0 {
+		return nil
+	}
+
+	for _, name := range names {
+		pattern := patterns.Get(name)
+		if pattern == nil || !pattern.GetBase().RunsUserCode() {
+			continue
+		}
+
+		u, err := util.InvokingUser()
+		if err != nil {
+			return err
+		}
+
+		if strconv.Itoa(peer.Uid) != u.Uid {
+			return fmt.Errorf("only %s may run the %s pattern", u.Username, name)
+		}
+	}
+
+	return nil
+}
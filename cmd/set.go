@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"strconv"
 
 	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
@@ -9,7 +10,7 @@ import (
 )
 
 var setCmd = &cobra.Command{
-	Use:   "set { list | <color-name> | <color-hex-code> | <brightness-number> }...",
+	Use:   "set { list | <color-name> | <color-hex-code> | <brightness-number> | <+/-brightness-change> }...",
 	Short: "Sets the color and/or brightness of the keyboard",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -26,6 +27,16 @@ var setCmd = &cobra.Command{
 				continue
 			}
 
+			if arg[0] == '+' || arg[0] == '-' {
+				// relative change to the current brightness (use "--" before negative values)
+				err := adjustBrightness(arg)
+				if err != nil {
+					return fail(13, err)
+				}
+
+				continue
+			}
+
 			val, err := strconv.Atoi(arg)
 			if err == nil && val < 256 {
 				err := keyboard.BrightnessFileHandler(arg)
@@ -46,6 +57,33 @@ var setCmd = &cobra.Command{
 	},
 }
 
+func adjustBrightness(change string) error {
+	delta, err := strconv.Atoi(change)
+	if err != nil {
+		return fmt.Errorf("can't parse brightness change %s: %w", change, err)
+	}
+
+	// relative to what's beneath any overlay (e.g. while toggled off)
+	current, err := keyboard.GetBaseBrightness()
+	if err != nil {
+		return err
+	}
+
+	val, err := strconv.Atoi(current)
+	if err != nil {
+		return fmt.Errorf("can't parse current brightness %s: %w", current, err)
+	}
+
+	val += delta
+	if val < 0 {
+		val = 0
+	} else if val > 255 {
+		val = 255
+	}
+
+	return keyboard.BrightnessFileHandler(strconv.Itoa(val))
+}
+
 func init() {
 	rootCmd.AddCommand(setCmd)
 }
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Reports statistics collected by patterns",
+}
+
+var typingStatsCmd = &cobra.Command{
+	Use:   "typing",
+	Short: "Reports words per minute, session totals, and hourly and daily key presses of the typing pattern",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
+			return sendViaIPC(cmd)
+		}
+
+		typing := patterns.Get("typing").(*patterns.TypingPattern)
+		stats := typing.Stats()
+		if stats == nil {
+			return fail(11, errors.New("typing pattern has not been run"))
+		}
+
+		cmd.Println(stats)
+		return nil
+	},
+}
+
+func init() {
+	statsCmd.AddCommand(typingStatsCmd)
+	rootCmd.AddCommand(statsCmd)
+}
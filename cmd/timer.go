@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/BitPonyLLC/huekeys/pkg/patterns"
+
+	"github.com/spf13/cobra"
+)
+
+var timerCmd = &cobra.Command{
+	Use:       "timer { pause | resume | skip }",
+	Short:     "Controls a running timer pattern",
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"pause", "resume", "skip"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
+			return sendViaIPC(cmd)
+		}
+
+		timer, ok := patterns.GetRunning().(*patterns.TimerPattern)
+		if !ok {
+			return fail(11, errors.New("timer pattern is not running"))
+		}
+
+		switch args[0] {
+		case "pause":
+			timer.Pause()
+		case "resume":
+			timer.Resume()
+		case "skip":
+			timer.Skip()
+		}
+
+		cmd.Println("running =", timer)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(timerCmd)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+
+	"github.com/spf13/cobra"
+)
+
+// offOverlay is used by the wait process to keep the keyboard off (even while
+// patterns change the brightness) until toggled back on.
+var offOverlay *keyboard.Overlay
+
+// OffOverlayPriority is higher than any other overlay as nothing should show
+// while the keyboard is toggled off.
+const OffOverlayPriority = 1000
+
+var toggleCmd = &cobra.Command{
+	Use:   "toggle",
+	Short: "Turns the keyboard lights off or back on",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if waitPidPath.IsRunning() && !waitPidPath.IsOurs() {
+			return sendViaIPC(cmd)
+		}
+
+		if !waitPidPath.IsOurs() {
+			// nothing will be around to restore the brightness: simply flip it
+			brightness, err := keyboard.GetCurrentBrightness()
+			if err != nil {
+				return fail(11, err)
+			}
+
+			if brightness == "0" {
+				brightness = "255"
+			} else {
+				brightness = "0"
+			}
+
+			cmd.Println("brightness =", brightness)
+			return keyboard.BrightnessFileHandler(brightness)
+		}
+
+		if offOverlay != nil {
+			err := offOverlay.Remove()
+			offOverlay = nil
+			if err != nil {
+				return fail(12, err)
+			}
+
+			cmd.Println("on")
+			return nil
+		}
+
+		offOverlay = keyboard.AddOverlay("off", OffOverlayPriority)
+		err := offOverlay.SetBrightness("0")
+		if err != nil {
+			return fail(13, err)
+		}
+
+		cmd.Println("off")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(toggleCmd)
+}
@@ -0,0 +1,160 @@
+package desktop
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// dconfDatabase is the dconf settings database of a user (a GVariant database
+// file) read directly, without running commands as the user. Only the values
+// the user has set are found here: defaults come from the settings schemas.
+type dconfDatabase struct {
+	order binary.ByteOrder
+	data  []byte
+	items map[string]gvdbItem // by full key (e.g. /org/gnome/desktop/interface/color-scheme)
+}
+
+type gvdbItem struct {
+	typ        byte
+	start, end uint32
+}
+
+const dconfUserFile = ".config/dconf/user"
+
+// sizes of the GVariant database structures
+const gvdbHeaderSize = 24
+const gvdbHashHeaderSize = 8
+const gvdbItemSize = 24
+
+const gvdbNoParent = 0xffffffff
+
+var errDconfUnset = errors.New("not set in dconf database")
+
+// readDconf loads the database in the file provided.
+func readDconf(path string) (*dconfDatabase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read dconf database: %w", err)
+	}
+
+	db := &dconfDatabase{data: data, items: map[string]gvdbItem{}}
+
+	if len(data) < gvdbHeaderSize {
+		return nil, fmt.Errorf("invalid dconf database %s: too short", path)
+	}
+
+	switch string(data[:8]) {
+	case "GVariant":
+		db.order = binary.LittleEndian
+	case "raVGtnai":
+		db.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid dconf database %s: unknown signature", path)
+	}
+
+	err = db.loadTable(db.order.Uint32(data[16:]), db.order.Uint32(data[20:]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid dconf database %s: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// String returns the string value of a key (e.g. a URI or an enum's nick).
+func (db *dconfDatabase) String(key string) (string, error) {
+	item, found := db.items[key]
+	if !found || item.typ != 'v' {
+		return "", errDconfUnset
+	}
+
+	// a serialized variant is its value followed by a zero and its type
+	value := db.data[item.start:item.end]
+	sep := bytes.LastIndexByte(value, 0)
+	if sep < 0 {
+		return "", fmt.Errorf("invalid value of %s", key)
+	}
+
+	if typ := string(value[sep+1:]); typ != "s" {
+		return "", fmt.Errorf("unexpected type of %s: %s", key, typ)
+	}
+
+	return string(bytes.TrimSuffix(value[:sep], []byte{0})), nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// loadTable indexes all the items of the hash table at the location provided,
+// naming each with its full key (i.e. prefixed by the names of its parents).
+func (db *dconfDatabase) loadTable(start, end uint32) error {
+	if start > end || int(end) > len(db.data) || end-start < gvdbHashHeaderSize {
+		return errors.New("bad hash table location")
+	}
+
+	table := db.data[start:end]
+	bloomWords := db.order.Uint32(table) & (1<<27 - 1)
+	buckets := db.order.Uint32(table[4:])
+
+	itemsStart := uint64(gvdbHashHeaderSize) + 4*uint64(bloomWords) + 4*uint64(buckets)
+	if itemsStart > uint64(len(table)) {
+		return errors.New("bad hash table size")
+	}
+
+	raw := table[itemsStart:]
+	count := len(raw) / gvdbItemSize
+
+	type entry struct {
+		parent uint32
+		key    string
+		item   gvdbItem
+	}
+
+	entries := make([]entry, count)
+	for i := range entries {
+		b := raw[i*gvdbItemSize : (i+1)*gvdbItemSize]
+		keyStart := db.order.Uint32(b[8:])
+		keyEnd := uint64(keyStart) + uint64(db.order.Uint16(b[12:]))
+		if keyEnd > uint64(len(db.data)) {
+			return errors.New("bad key location")
+		}
+
+		item := gvdbItem{typ: b[14], start: db.order.Uint32(b[16:]), end: db.order.Uint32(b[20:])}
+		if item.typ == 'v' && (item.start > item.end || int(item.end) > len(db.data)) {
+			return errors.New("bad value location")
+		}
+
+		entries[i] = entry{parent: db.order.Uint32(b[4:]), key: string(db.data[keyStart:keyEnd]), item: item}
+	}
+
+	var fullName func(i uint32, depth int) (string, error)
+	fullName = func(i uint32, depth int) (string, error) {
+		if depth > count {
+			return "", errors.New("parent loop")
+		}
+
+		e := entries[i]
+		if e.parent == gvdbNoParent {
+			return e.key, nil
+		}
+
+		if int(e.parent) >= count {
+			return "", errors.New("bad parent")
+		}
+
+		parent, err := fullName(e.parent, depth+1)
+		return parent + e.key, err
+	}
+
+	for i, e := range entries {
+		name, err := fullName(uint32(i), 0)
+		if err != nil {
+			return err
+		}
+		db.items[name] = e.item
+	}
+
+	return nil
+}
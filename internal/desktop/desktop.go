@@ -0,0 +1,227 @@
+// Package desktop reports the wallpaper (background picture) of the various
+// desktop environments and window managers, along with when it changes.
+package desktop
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// Env describes the desktop session of the user whose wallpaper is followed.
+type Env struct {
+	User           string // when set, commands are run as this user
+	RuntimeDir     string // XDG_RUNTIME_DIR of the user's session
+	CurrentDesktop string // XDG_CURRENT_DESKTOP of the user's session (e.g. "ubuntu:GNOME")
+	Home           string
+}
+
+// Source reports the wallpaper of a desktop environment.
+type Source interface {
+	// Wallpaper returns the path of the current wallpaper.
+	Wallpaper() (string, error)
+
+	// Files returns the configuration files that are written when the
+	// wallpaper changes.
+	Files() []string
+}
+
+// SettleDelay allows a burst of writes to a configuration file to finish before
+// the wallpaper is read again.
+const SettleDelay = 250 * time.Millisecond
+
+// Names returns the names of all sources.
+func Names() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the source with the provided name or, if the name is empty, the
+// source that suits the env's current desktop.
+func New(name string, env *Env) (Source, error) {
+	if name == "" {
+		name = Detect(env)
+	}
+
+	newSource := sources[name]
+	if newSource == nil {
+		return nil, fmt.Errorf("unknown desktop source: %s (expected one of %s)", name, strings.Join(Names(), ", "))
+	}
+
+	return newSource(env), nil
+}
+
+// Detect returns the name of the source that suits the env's current desktop.
+// When the desktop isn't recognized, feh is used if it has been set up;
+// otherwise, gnome.
+func Detect(env *Env) string {
+	for _, desktop := range strings.Split(strings.ToLower(env.CurrentDesktop), ":") {
+		if name := desktopSources[strings.TrimPrefix(desktop, "x-")]; name != "" {
+			return name
+		}
+	}
+
+	if _, err := os.Stat(env.path(".fehbg")); err == nil {
+		return "feh"
+	}
+
+	return "gnome"
+}
+
+// Watch will call changed with the path of the wallpaper every time it changes
+// until the context is canceled.
+func Watch(ctx context.Context, log *zerolog.Logger, src Source, changed func(string)) error {
+	last, _ := src.Wallpaper()
+
+	return watchFiles(ctx, log, src.Files(), func() {
+		path, err := src.Wallpaper()
+		if err != nil {
+			log.Warn().Err(err).Msg("can't get wallpaper")
+			return
+		}
+
+		if path != last {
+			last = path
+			changed(path)
+		}
+	})
+}
+
+// Command returns a command that runs as the env's user (if any), within their
+// desktop session. When run as root, the command is started directly with the
+// user's credentials (i.e. without sudo or a shell).
+func (env *Env) Command(name string, args ...string) (*exec.Cmd, error) {
+	cmd := exec.Command(name, args...)
+	if env.User == "" {
+		return cmd, nil
+	}
+
+	u, err := user.Lookup(env.User)
+	if err != nil {
+		return nil, fmt.Errorf("can't find desktop user: %w", err)
+	}
+
+	extra := []string{}
+	if env.RuntimeDir != "" {
+		extra = append(extra, "XDG_RUNTIME_DIR="+env.RuntimeDir,
+			"DBUS_SESSION_BUS_ADDRESS=unix:path="+filepath.Join(env.RuntimeDir, "bus"))
+	}
+
+	err = util.RunAs(cmd, u, extra...)
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+var sources = map[string]func(*Env) Source{}
+
+// desktopSources maps XDG_CURRENT_DESKTOP values to sources
+var desktopSources = map[string]string{}
+
+// watchFiles calls check once writes to any of the files have settled, until
+// the context is canceled.
+func watchFiles(ctx context.Context, log *zerolog.Logger, paths []string, check func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("can't create desktop watcher: %w", err)
+	}
+
+	files := map[string]bool{}
+	for _, file := range paths {
+		// watch the directory to follow files being replaced (i.e. written
+		// elsewhere and renamed)
+		err = watcher.Add(filepath.Dir(file))
+		if err != nil {
+			log.Warn().Err(err).Str("path", file).Msg("can't watch desktop configuration")
+			continue
+		}
+		files[filepath.Clean(file)] = true
+	}
+
+	if len(files) == 0 {
+		watcher.Close()
+		return fmt.Errorf("no desktop configuration to watch")
+	}
+
+	go func() {
+		defer util.LogRecover()
+		defer watcher.Close()
+
+		settle := time.NewTimer(SettleDelay)
+		settle.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				settle.Stop()
+				return
+			case err := <-watcher.Errors:
+				log.Warn().Err(err).Msg("desktop watcher failed")
+			case ev := <-watcher.Events:
+				if files[filepath.Clean(ev.Name)] && ev.Op&fsnotify.Chmod == 0 {
+					settle.Reset(SettleDelay)
+				}
+			case <-settle.C:
+				check()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func register(name string, newSource func(*Env) Source, desktops ...string) {
+	sources[name] = newSource
+	for _, desktop := range desktops {
+		desktopSources[desktop] = name
+	}
+}
+
+// path returns the location of a file relative to the env's home directory
+func (env *Env) path(rel string) string {
+	return filepath.Join(env.Home, rel)
+}
+
+// expandPath converts a file URL or a path relative to the env's home directory
+// into an absolute path.
+func (env *Env) expandPath(val string) string {
+	val = strings.Trim(strings.TrimSpace(val), `'"`)
+
+	if strings.HasPrefix(val, "file://") {
+		if u, err := url.Parse(val); err == nil {
+			return u.Path
+		}
+	}
+
+	switch {
+	case val == "~":
+		return env.Home
+	case strings.HasPrefix(val, "~/"):
+		return env.path(val[2:])
+	case strings.HasPrefix(val, "$HOME/"):
+		return env.path(val[6:])
+	}
+
+	return val
+}
@@ -0,0 +1,61 @@
+package desktop
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// fehSource reads the wallpaper from the script feh writes to restore the
+// background (used by many X11 window managers), e.g.:
+//
+//	feh --no-fehbg --bg-fill '/home/me/Pictures/wall.jpg'
+type fehSource struct {
+	env *Env
+}
+
+const fehbgFile = ".fehbg"
+
+func init() {
+	register("feh", func(env *Env) Source { return &fehSource{env: env} })
+}
+
+func (s *fehSource) Wallpaper() (string, error) {
+	path := ""
+	err := eachLine(s.env.path(fehbgFile), func(line string) bool {
+		args, err := shellwords.Parse(line)
+		if err != nil || len(args) == 0 || filepath.Base(args[0]) != "feh" {
+			return true
+		}
+
+		// the first image is shown on the first screen
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--image-bg" {
+				i++ // skip its color
+				continue
+			}
+
+			if !strings.HasPrefix(args[i], "-") {
+				path = args[i]
+				return false
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		return "", fmt.Errorf("no wallpaper found in %s", s.env.path(fehbgFile))
+	}
+
+	return s.env.expandPath(path), nil
+}
+
+func (s *fehSource) Files() []string {
+	return []string{s.env.path(fehbgFile)}
+}
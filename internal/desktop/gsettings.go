@@ -0,0 +1,97 @@
+package desktop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// gsettingsSource reads the wallpaper from the settings schemas used by GNOME
+// and the desktops derived from it. Values are read directly from the user's
+// dconf database, only running gsettings (as the user) for the defaults of
+// those never changed.
+type gsettingsSource struct {
+	env    *Env
+	schema string
+	key    string
+	dark   bool // use the "-dark" key when the color scheme prefers dark
+}
+
+func init() {
+	register("gnome", func(env *Env) Source {
+		return &gsettingsSource{env: env, schema: "org.gnome.desktop.background", key: "picture-uri", dark: true}
+	}, "gnome", "unity", "ubuntu", "budgie", "pantheon")
+
+	register("cinnamon", func(env *Env) Source {
+		return &gsettingsSource{env: env, schema: "org.cinnamon.desktop.background", key: "picture-uri"}
+	}, "cinnamon")
+
+	register("mate", func(env *Env) Source {
+		return &gsettingsSource{env: env, schema: "org.mate.background", key: "picture-filename"}
+	}, "mate")
+}
+
+func (s *gsettingsSource) Wallpaper() (string, error) {
+	key := s.key
+	if s.dark {
+		scheme, err := s.get("org.gnome.desktop.interface", "color-scheme")
+		if err == nil && scheme == "prefer-dark" {
+			key += "-dark"
+		}
+	}
+
+	val, err := s.get(s.schema, key)
+	if err != nil {
+		return "", err
+	}
+
+	if val == "" {
+		return "", fmt.Errorf("no wallpaper set in %s %s", s.schema, key)
+	}
+
+	return s.env.expandPath(val), nil
+}
+
+// Files returns the dconf database, rewritten whenever a setting changes.
+func (s *gsettingsSource) Files() []string {
+	return []string{s.env.path(dconfUserFile)}
+}
+
+// schemaPaths are the dconf paths of schemas not simply named by their path
+var schemaPaths = map[string]string{
+	"org.mate.background": "/org/mate/desktop/background/",
+}
+
+func (s *gsettingsSource) get(schema, key string) (string, error) {
+	path := schemaPaths[schema]
+	if path == "" {
+		path = "/" + strings.ReplaceAll(schema, ".", "/") + "/"
+	}
+
+	db, err := readDconf(s.env.path(dconfUserFile))
+	if err == nil {
+		val, err := db.String(path + key)
+		if err == nil {
+			return val, nil
+		}
+		if !errors.Is(err, errDconfUnset) {
+			return "", fmt.Errorf("can't get %s %s: %w", schema, key, err)
+		}
+	}
+
+	// never changed by the user (or no database yet): use the default
+	cmd, err := s.env.Command("gsettings", "get", schema, key)
+	if err != nil {
+		return "", err
+	}
+
+	val, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("can't get %s %s: %w", schema, key, err)
+	}
+
+	val = bytes.TrimFunc(val, func(r rune) bool { return unicode.IsSpace(r) || r == '\'' })
+	return string(val), nil
+}
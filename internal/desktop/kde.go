@@ -0,0 +1,106 @@
+package desktop
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// kdeSource reads the wallpaper from the Plasma desktop configuration, where
+// each desktop containment has its own wallpaper settings, e.g.:
+//
+//	[Containments][1][Wallpaper][org.kde.image][General]
+//	Image=file:///usr/share/wallpapers/Next/
+type kdeSource struct {
+	env *Env
+}
+
+const kdeAppletsFile = ".config/plasma-org.kde.plasma.desktop-appletsrc"
+
+const kdeImageGroupSuffix = "[Wallpaper][org.kde.image][General]"
+
+func init() {
+	register("kde", func(env *Env) Source { return &kdeSource{env: env} }, "kde")
+}
+
+func (s *kdeSource) Wallpaper() (string, error) {
+	f, err := os.Open(s.env.path(kdeAppletsFile))
+	if err != nil {
+		return "", fmt.Errorf("can't open plasma configuration: %w", err)
+	}
+	defer f.Close()
+
+	inImageGroup := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inImageGroup = strings.HasSuffix(line, kdeImageGroupSuffix)
+			continue
+		}
+
+		if !inImageGroup {
+			continue
+		}
+
+		key, val, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(key) == "Image" && strings.TrimSpace(val) != "" {
+			// the first desktop (i.e. the primary screen) is used
+			return packageImage(s.env.expandPath(val)), nil
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return "", fmt.Errorf("can't read plasma configuration: %w", err)
+	}
+
+	return "", fmt.Errorf("no wallpaper image found in %s", f.Name())
+}
+
+func (s *kdeSource) Files() []string {
+	return []string{s.env.path(kdeAppletsFile)}
+}
+
+// packageImage returns the largest image of a wallpaper package (i.e. a
+// directory with images named by resolution in contents/images) or the path
+// itself when it isn't a package.
+func packageImage(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return path
+	}
+
+	entries, err := os.ReadDir(filepath.Join(path, "contents", "images"))
+	if err != nil {
+		return path
+	}
+
+	best := ""
+	bestArea := -1
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		// e.g. 1920x1080.png
+		area := 0
+		var width, height int
+		if _, err := fmt.Sscanf(entry.Name(), "%dx%d", &width, &height); err == nil {
+			area = width * height
+		}
+
+		if area > bestArea {
+			best = entry.Name()
+			bestArea = area
+		}
+	}
+
+	if best == "" {
+		return path
+	}
+
+	return filepath.Join(path, "contents", "images", best)
+}
@@ -0,0 +1,185 @@
+package desktop
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Theme describes the system accent color and light or dark preference of a
+// desktop environment.
+type Theme struct {
+	Accent string // hex RGB (empty when the desktop has none)
+	Dark   bool
+}
+
+// ThemeSource reports the theme of a desktop environment.
+type ThemeSource interface {
+	// Theme returns the current theme.
+	Theme() (Theme, error)
+
+	// Files returns the configuration files that are written when the theme
+	// changes.
+	Files() []string
+}
+
+// gnomeAccents are the colors of GNOME's named accents (GNOME 47+).
+var gnomeAccents = map[string]string{
+	"blue":   "3584E4",
+	"teal":   "2190A4",
+	"green":  "3A944A",
+	"yellow": "C88800",
+	"orange": "ED5B00",
+	"red":    "E62D42",
+	"pink":   "D56199",
+	"purple": "9141AC",
+	"slate":  "6F8396",
+}
+
+// ThemeNames returns the names of all theme sources.
+func ThemeNames() []string {
+	return []string{"gnome", "kde"}
+}
+
+// NewTheme returns the theme source with the provided name or, if the name is
+// empty, the one that suits the env's current desktop.
+func NewTheme(name string, env *Env) (ThemeSource, error) {
+	if name == "" {
+		name = "gnome"
+		if Detect(env) == "kde" {
+			name = "kde"
+		}
+	}
+
+	switch name {
+	case "gnome":
+		return &gnomeTheme{gsettingsSource{env: env}}, nil
+	case "kde":
+		return &kdeTheme{env: env}, nil
+	}
+
+	return nil, fmt.Errorf("unknown theme source: %s (expected one of %s)", name, strings.Join(ThemeNames(), ", "))
+}
+
+// WatchTheme will call changed with the theme every time it changes until the
+// context is canceled.
+func WatchTheme(ctx context.Context, log *zerolog.Logger, src ThemeSource, changed func(Theme)) error {
+	last, _ := src.Theme()
+
+	return watchFiles(ctx, log, src.Files(), func() {
+		theme, err := src.Theme()
+		if err != nil {
+			log.Warn().Err(err).Msg("can't get theme")
+			return
+		}
+
+		if theme != last {
+			last = theme
+			changed(theme)
+		}
+	})
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// gnomeTheme reads the accent color and color scheme from the GNOME interface
+// settings, e.g.:
+//
+//	org.gnome.desktop.interface accent-color 'teal'
+//	org.gnome.desktop.interface color-scheme 'prefer-dark'
+type gnomeTheme struct {
+	gsettingsSource
+}
+
+// kdeTheme reads the accent color and color scheme from the Plasma global
+// configuration, e.g.:
+//
+//	[General]
+//	AccentColor=61,174,233
+//	ColorScheme=BreezeDark
+type kdeTheme struct {
+	env *Env
+}
+
+const kdeGlobalsFile = ".config/kdeglobals"
+
+func (t *gnomeTheme) Theme() (Theme, error) {
+	scheme, err := t.get("org.gnome.desktop.interface", "color-scheme")
+	if err != nil {
+		return Theme{}, err
+	}
+
+	theme := Theme{Dark: scheme == "prefer-dark"}
+
+	// older versions have no accent color
+	if accent, err := t.get("org.gnome.desktop.interface", "accent-color"); err == nil {
+		theme.Accent = gnomeAccents[accent]
+	}
+
+	return theme, nil
+}
+
+func (t *kdeTheme) Theme() (Theme, error) {
+	group := ""
+	values := map[string]string{}
+	err := eachLine(t.env.path(kdeGlobalsFile), func(line string) bool {
+		if strings.HasPrefix(line, "[") {
+			group = line
+			return true
+		}
+
+		if key, val, found := strings.Cut(line, "="); found {
+			values[group+strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+
+		return true
+	})
+	if err != nil {
+		return Theme{}, err
+	}
+
+	theme := Theme{}
+
+	// without a chosen accent, the selection color of the scheme is used
+	theme.Accent = kdeColor(values["[General]AccentColor"])
+	if theme.Accent == "" {
+		theme.Accent = kdeColor(values["[Colors:Selection]BackgroundNormal"])
+	}
+
+	if scheme := values["[General]ColorScheme"]; strings.Contains(strings.ToLower(scheme), "dark") {
+		theme.Dark = true
+	} else if window := kdeColor(values["[Colors:Window]BackgroundNormal"]); window != "" {
+		var r, g, b int
+		fmt.Sscanf(window, "%02X%02X%02X", &r, &g, &b)
+		theme.Dark = 0.2126*float64(r)+0.7152*float64(g)+0.0722*float64(b) < 128
+	}
+
+	return theme, nil
+}
+
+func (t *kdeTheme) Files() []string {
+	return []string{t.env.path(kdeGlobalsFile)}
+}
+
+// kdeColor converts a color written as "r,g,b" (or "r,g,b,a") into hex RGB
+func kdeColor(val string) string {
+	parts := strings.Split(val, ",")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	hex := ""
+	for _, part := range parts[:3] {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 || n > 255 {
+			return ""
+		}
+		hex += fmt.Sprintf("%02X", n)
+	}
+
+	return hex
+}
@@ -0,0 +1,163 @@
+package desktop
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// swaySource reads the wallpaper from the sway configuration, set either by an
+// output background or by running swaybg directly, e.g.:
+//
+//	output * bg ~/Pictures/wall.jpg fill
+//	exec swaybg -i ~/Pictures/wall.jpg -m fill
+type swaySource struct {
+	env *Env
+}
+
+// hyprpaperSource reads the wallpaper from the hyprpaper configuration used
+// with Hyprland, e.g.:
+//
+//	preload = ~/Pictures/wall.jpg
+//	wallpaper = eDP-1,~/Pictures/wall.jpg
+type hyprpaperSource struct {
+	env *Env
+}
+
+const swayConfigFile = ".config/sway/config"
+const hyprpaperConfigFile = ".config/hypr/hyprpaper.conf"
+
+func init() {
+	register("sway", func(env *Env) Source { return &swaySource{env: env} }, "sway")
+	register("hyprland", func(env *Env) Source { return &hyprpaperSource{env: env} }, "hyprland")
+}
+
+func (s *swaySource) Wallpaper() (string, error) {
+	path := ""
+	err := eachLine(s.env.path(swayConfigFile), func(line string) bool {
+		args, err := shellwords.Parse(line)
+		if err != nil || len(args) < 2 {
+			return true
+		}
+
+		switch args[0] {
+		case "output":
+			// output <name> bg|background <file> [<mode>]
+			if len(args) > 3 && (args[2] == "bg" || args[2] == "background") {
+				path = args[3]
+			}
+		case "exec", "exec_always":
+			path = swaybgImage(args[1:])
+		}
+
+		return path == ""
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		return "", fmt.Errorf("no wallpaper found in %s", s.env.path(swayConfigFile))
+	}
+
+	return s.env.expandPath(path), nil
+}
+
+func (s *swaySource) Files() []string {
+	return []string{s.env.path(swayConfigFile)}
+}
+
+func (s *hyprpaperSource) Wallpaper() (string, error) {
+	wallpaper := ""
+	preload := ""
+	err := eachLine(s.env.path(hyprpaperConfigFile), func(line string) bool {
+		key, val, found := strings.Cut(line, "=")
+		if !found {
+			return true
+		}
+
+		val = strings.TrimSpace(val)
+		switch strings.TrimSpace(key) {
+		case "wallpaper":
+			// the monitor may be empty to apply to all of them (e.g. ",~/wall.jpg")
+			if _, path, found := strings.Cut(val, ","); found {
+				wallpaper = strings.TrimSpace(path)
+			}
+		case "path":
+			// within a "wallpaper { ... }" block
+			wallpaper = val
+		case "preload":
+			if preload == "" {
+				preload = val
+			}
+		}
+
+		return wallpaper == ""
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if wallpaper == "" {
+		wallpaper = preload
+	}
+
+	if wallpaper == "" {
+		return "", fmt.Errorf("no wallpaper found in %s", s.env.path(hyprpaperConfigFile))
+	}
+
+	return s.env.expandPath(wallpaper), nil
+}
+
+func (s *hyprpaperSource) Files() []string {
+	return []string{s.env.path(hyprpaperConfigFile)}
+}
+
+// swaybgImage returns the image passed to a swaybg command (if any)
+func swaybgImage(args []string) string {
+	if len(args) == 0 || !strings.HasSuffix(args[0], "swaybg") {
+		return ""
+	}
+
+	for i, arg := range args[1:] {
+		if (arg == "-i" || arg == "--image") && i+2 < len(args) {
+			return args[i+2]
+		}
+		if strings.HasPrefix(arg, "--image=") {
+			return strings.TrimPrefix(arg, "--image=")
+		}
+	}
+
+	return ""
+}
+
+// eachLine calls fn with every line of a file that isn't blank or a comment,
+// until fn returns false.
+func eachLine(path string, fn func(string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open desktop configuration: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !fn(line) {
+			return nil
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("can't read desktop configuration: %w", err)
+	}
+
+	return nil
+}
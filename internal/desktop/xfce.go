@@ -0,0 +1,70 @@
+package desktop
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+// xfceSource reads the wallpaper from the xfconf channel of the XFCE desktop,
+// where each monitor and workspace has its own backdrop properties, e.g.:
+//
+//	/backdrop/screen0/monitoreDP-1/workspace0/last-image
+type xfceSource struct {
+	env *Env
+}
+
+type xfconfProperty struct {
+	Name       string           `xml:"name,attr"`
+	Value      string           `xml:"value,attr"`
+	Properties []xfconfProperty `xml:"property"`
+}
+
+const xfceDesktopFile = ".config/xfce4/xfconf/xfce-perchannel-xml/xfce4-desktop.xml"
+
+func init() {
+	register("xfce", func(env *Env) Source { return &xfceSource{env: env} }, "xfce")
+}
+
+func (s *xfceSource) Wallpaper() (string, error) {
+	data, err := os.ReadFile(s.env.path(xfceDesktopFile))
+	if err != nil {
+		return "", fmt.Errorf("can't read xfce desktop configuration: %w", err)
+	}
+
+	channel := xfconfProperty{}
+	err = xml.Unmarshal(data, &channel)
+	if err != nil {
+		return "", fmt.Errorf("can't parse xfce desktop configuration: %w", err)
+	}
+
+	// older versions only use image-path
+	for _, name := range []string{"last-image", "image-path"} {
+		val := findXfconfValue(channel.Properties, name)
+		if val != "" {
+			return s.env.expandPath(val), nil
+		}
+	}
+
+	return "", fmt.Errorf("no wallpaper image found in %s", s.env.path(xfceDesktopFile))
+}
+
+func (s *xfceSource) Files() []string {
+	return []string{s.env.path(xfceDesktopFile)}
+}
+
+// findXfconfValue returns the value of the first property with the name
+// provided, searching depth first (i.e. the first monitor and workspace)
+func findXfconfValue(props []xfconfProperty, name string) string {
+	for _, prop := range props {
+		if prop.Name == name && prop.Value != "" {
+			return prop.Value
+		}
+
+		if val := findXfconfValue(prop.Properties, name); val != "" {
+			return val
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,217 @@
+package image_matcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxCachedFiles is the number of pictures whose palettes are kept in the
+// cache before the least recently used are removed.
+const MaxCachedFiles = 100
+
+// cachedFile is the index entry of a picture, used to avoid hashing its
+// content again when it hasn't changed.
+type cachedFile struct {
+	Size     int64
+	ModTime  time.Time
+	Hash     string
+	LastUsed time.Time
+}
+
+// cachedColor is one color of a cached palette.
+type cachedColor struct {
+	R, G, B uint8
+	Share   float64
+}
+
+const cacheIndexFile = "files.json"
+
+// palettes are kept apart from anything else in the cache directory so that
+// pruning never removes files it didn't write
+const paletteDir = "palettes"
+
+// cachedPalette returns the palette previously extracted from a picture (if
+// any) along with the hash of its content needed to store one.
+func cachedPalette(dir, path string, opts *Options) ([]Swatch, string) {
+	index := readCacheIndex(dir)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, ""
+	}
+
+	entry, found := index[path]
+	if !found || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		hash, err := hashFile(path)
+		if err != nil {
+			return nil, ""
+		}
+
+		// a copied or touched picture still has the same colors
+		entry = cachedFile{Size: info.Size(), ModTime: info.ModTime(), Hash: hash}
+	}
+
+	entry.LastUsed = time.Now()
+	index[path] = entry
+	writeCacheIndex(dir, index)
+
+	palettes := readCachedPalettes(dir, entry.Hash)
+	colors, found := palettes[paletteKey(opts)]
+	if !found || len(colors) == 0 {
+		return nil, entry.Hash
+	}
+
+	palette := make([]Swatch, len(colors))
+	for i, c := range colors {
+		palette[i] = newSwatch(c.R, c.G, c.B, c.Share)
+	}
+
+	return palette, entry.Hash
+}
+
+// cachePalette stores the palette extracted from the content with the hash
+// provided. Failures are ignored: the palette is extracted again next time.
+func cachePalette(dir, hash string, opts *Options, palette []Swatch) {
+	if hash == "" {
+		return
+	}
+
+	colors := make([]cachedColor, len(palette))
+	for i, s := range palette {
+		r, g, b := s.RGB()
+		colors[i] = cachedColor{R: r, G: g, B: b, Share: s.Share}
+	}
+
+	palettes := readCachedPalettes(dir, hash)
+	palettes[paletteKey(opts)] = colors
+	writeCacheFile(filepath.Join(dir, paletteDir), hash+".json", palettes)
+
+	pruneCache(dir)
+}
+
+// paletteKey identifies the options affecting extraction (i.e. not those only
+// affecting which color is chosen).
+func paletteKey(opts *Options) string {
+	return fmt.Sprintf("clusters=%d center-weighted=%t", opts.Clusters, opts.CenterWeighted)
+}
+
+// pruneCache removes the least recently used pictures beyond MaxCachedFiles
+// along with any palettes no longer used by a picture.
+func pruneCache(dir string) {
+	index := readCacheIndex(dir)
+	if len(index) > MaxCachedFiles {
+		paths := make([]string, 0, len(index))
+		for path := range index {
+			paths = append(paths, path)
+		}
+
+		sort.Slice(paths, func(i, j int) bool { return index[paths[i]].LastUsed.After(index[paths[j]].LastUsed) })
+		for _, path := range paths[MaxCachedFiles:] {
+			delete(index, path)
+		}
+
+		writeCacheIndex(dir, index)
+	}
+
+	used := map[string]bool{}
+	for _, entry := range index {
+		used[entry.Hash+".json"] = true
+	}
+
+	palettesDir := filepath.Join(dir, paletteDir)
+	entries, _ := os.ReadDir(palettesDir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if isPaletteFile(name) && !used[name] {
+			os.Remove(filepath.Join(palettesDir, name))
+		}
+	}
+}
+
+// isPaletteFile reports if the name is one given to a palette (i.e. a content
+// hash with a ".json" extension).
+func isPaletteFile(name string) bool {
+	hash := strings.TrimSuffix(name, ".json")
+	if hash == name || len(hash) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readCacheIndex(dir string) map[string]cachedFile {
+	index := map[string]cachedFile{}
+	readCacheFile(dir, cacheIndexFile, &index)
+	return index
+}
+
+func writeCacheIndex(dir string, index map[string]cachedFile) {
+	writeCacheFile(dir, cacheIndexFile, index)
+}
+
+func readCachedPalettes(dir, hash string) map[string][]cachedColor {
+	palettes := map[string][]cachedColor{}
+	readCacheFile(filepath.Join(dir, paletteDir), hash+".json", &palettes)
+	return palettes
+}
+
+func readCacheFile(dir, name string, val interface{}) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err == nil {
+		// a corrupt file is treated as empty and replaced
+		json.Unmarshal(data, val)
+	}
+}
+
+// writeCacheFile replaces the file atomically so that a reader never sees a
+// partial one.
+func writeCacheFile(dir, name string, val interface{}) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	f, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(data)
+	closeErr := f.Close()
+	if err != nil || closeErr != nil {
+		os.Remove(f.Name())
+		return
+	}
+
+	if err = os.Rename(f.Name(), filepath.Join(dir, name)); err != nil {
+		os.Remove(f.Name())
+	}
+}
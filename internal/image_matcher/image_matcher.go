@@ -4,13 +4,52 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	_ "image/gif"
 	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/EdlinOrg/prominentcolor"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
+// SupportedFormats are the kinds of images that can be matched.
+var SupportedFormats = []string{"jpeg", "png", "gif", "bmp", "tiff", "webp", "svg", "GNOME slideshow xml"}
+
+// pictureExtensions are the file extensions of the SupportedFormats (other than
+// slideshows)
+var pictureExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true,
+	".tif": true, ".tiff": true, ".webp": true, ".svg": true, ".svgz": true,
+}
+
+// IsPicture reports if a pathname has the extension of a supported picture.
+func IsPicture(pathname string) bool {
+	return pictureExtensions[strings.ToLower(filepath.Ext(pathname))]
+}
+
+// Resolve returns the picture currently shown for a pathname (i.e. following
+// a slideshow to its current picture).
+func Resolve(pathname string) (string, error) {
+	if strings.ToLower(filepath.Ext(pathname)) != ".xml" {
+		return pathname, nil
+	}
+
+	current, _, err := ResolveSlideshow(pathname, time.Now())
+	return current, err
+}
+
 func load(pathname string) (image.Image, error) {
+	switch strings.ToLower(filepath.Ext(pathname)) {
+	case ".svg", ".svgz":
+		return loadSVG(pathname)
+	}
+
 	f, err := os.Open(pathname)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open %s: %w", pathname, err)
@@ -18,6 +57,9 @@ func load(pathname string) (image.Image, error) {
 	defer f.Close()
 
 	img, _, err := image.Decode(f)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, unsupportedError(f)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode %s: %w", pathname, err)
 	}
@@ -25,27 +67,11 @@ func load(pathname string) (image.Image, error) {
 	return img, nil
 }
 
-func GetDominantColorOf(pathname string) (string, error) {
-	img, err := load(pathname)
-	if err != nil {
-		return "", err
-	}
-
-	colors, err := prominentcolor.KmeansWithArgs(prominentcolor.ArgumentNoCropping, img)
-	if err != nil {
-		return "", fmt.Errorf("unable to extract dominate color: %w", err)
-	}
-
-	var best *prominentcolor.ColorItem
-	for i, color := range colors {
-		if best == nil || color.Cnt > best.Cnt {
-			best = &colors[i]
-		}
-	}
-
-	if best == nil {
-		return "", errors.New("no colors found")
-	}
+// unsupportedError describes the kind of file that couldn't be decoded
+func unsupportedError(f *os.File) error {
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
 
-	return best.AsString(), nil
+	return fmt.Errorf("unsupported image type of %s (%s): expected one of %s",
+		f.Name(), http.DetectContentType(head[:n]), strings.Join(SupportedFormats, ", "))
 }
@@ -0,0 +1,316 @@
+package image_matcher
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	"github.com/EdlinOrg/prominentcolor"
+	"golang.org/x/image/draw"
+)
+
+// Strategies for choosing which color of a palette is the dominant one.
+const (
+	// CountStrategy chooses the color covering the most of the image.
+	CountStrategy = "count"
+	// VibrantStrategy favors bright, colorful colors over muddy ones, even
+	// when they cover less of the image.
+	VibrantStrategy = "vibrant"
+	// SaturatedStrategy chooses the color covering the most of the image
+	// among those at least as saturated as MinSaturation.
+	SaturatedStrategy = "saturated"
+)
+
+// Strategies are the names of all the supported selection strategies.
+var Strategies = []string{CountStrategy, VibrantStrategy, SaturatedStrategy}
+
+// Defaults used when options aren't provided.
+const (
+	DefaultStrategy      = VibrantStrategy
+	DefaultClusters      = 5
+	DefaultMinSaturation = 0.35
+)
+
+// near-black and near-white limits used when excluding extremes
+const darkValue = 0.15
+const lightValue = 0.9
+const lightSaturation = 0.1
+
+// the longest side of the image sampled when weighting by position
+const sampleSize = 128
+
+// the longest side of the image clustered: larger images are downscaled first
+// since decoding and resizing a 4K or 8K picture is the slowest part
+const analysisSize = 512
+
+// Options control how the palette of an image is extracted and which of its
+// colors is chosen as the dominant one.
+type Options struct {
+	Strategy        string  // one of Strategies
+	Clusters        int     // the number of colors (k) extracted
+	MinSaturation   float64 // the lowest saturation considered by SaturatedStrategy
+	ExcludeExtremes bool    // ignore near-black and near-white colors when possible
+	CenterWeighted  bool    // colors toward the center of the image count more
+	CacheDir        string  // where extracted palettes are kept (none are kept when empty)
+}
+
+// Swatch is one color of an image's palette.
+type Swatch struct {
+	Color      string  // hex RGB
+	Share      float64 // portion of the image (0.0 - 1.0) covered by the color
+	Saturation float64 // 0.0 - 1.0
+	Value      float64 // 0.0 - 1.0
+	Excluded   bool    // true if the color is near-black or near-white and extremes are excluded
+	Score      float64 // according to the strategy: the highest is the dominant color
+
+	r, g, b float64
+}
+
+// DefaultOptions returns the options used when none are provided.
+func DefaultOptions() *Options {
+	return &Options{
+		Strategy:        DefaultStrategy,
+		Clusters:        DefaultClusters,
+		MinSaturation:   DefaultMinSaturation,
+		ExcludeExtremes: true,
+	}
+}
+
+// GetDominantColorOf returns the hex RGB color chosen from the palette of an
+// image according to the options provided (or DefaultOptions when nil).
+func GetDominantColorOf(pathname string, opts *Options) (string, error) {
+	palette, err := GetPaletteOf(pathname, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return palette[0].Color, nil
+}
+
+// GetPaletteOf returns the colors extracted from an image, ordered from the
+// dominant color to the least fitting according to the options provided (or
+// DefaultOptions when nil).
+func GetPaletteOf(pathname string, opts *Options) ([]Swatch, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	score, err := scorer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Clusters < 1 {
+		return nil, fmt.Errorf("invalid number of clusters: %d", opts.Clusters)
+	}
+
+	path, err := Resolve(pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	var palette []Swatch
+	var hash string
+	if opts.CacheDir != "" {
+		palette, hash = cachedPalette(opts.CacheDir, path, opts)
+	}
+
+	if palette == nil {
+		palette, err = extractPalette(path, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.CacheDir != "" {
+			cachePalette(opts.CacheDir, hash, opts, palette)
+		}
+	}
+
+	for i := range palette {
+		s := &palette[i]
+		s.Excluded = opts.ExcludeExtremes && s.isExtreme()
+		s.Score = score(s)
+		if s.Excluded {
+			// still available when there's nothing else
+			s.Score -= 2
+		}
+	}
+
+	sort.SliceStable(palette, func(i, j int) bool { return palette[i].Score > palette[j].Score })
+
+	return palette, nil
+}
+
+// RGB returns the red, green, and blue components of the swatch's color.
+func (s *Swatch) RGB() (uint8, uint8, uint8) {
+	return uint8(math.Round(s.r * 255)), uint8(math.Round(s.g * 255)), uint8(math.Round(s.b * 255))
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+func scorer(opts *Options) (func(*Swatch) float64, error) {
+	switch opts.Strategy {
+	case CountStrategy:
+		return func(s *Swatch) float64 { return s.Share }, nil
+	case VibrantStrategy, "":
+		return func(s *Swatch) float64 { return math.Sqrt(s.Share) * s.Saturation * s.Value }, nil
+	case SaturatedStrategy:
+		return func(s *Swatch) float64 {
+			if s.Saturation < opts.MinSaturation {
+				// ranked after all the saturated colors
+				return s.Share - 1
+			}
+			return s.Share
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown strategy %q: expected one of %v", opts.Strategy, Strategies)
+}
+
+// extractPalette finds the colors of a picture along with how much of it each
+// one covers.
+func extractPalette(path string, opts *Options) ([]Swatch, error) {
+	img, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img = downscale(img)
+
+	// no masks: a plain white, black, or green picture is still a picture
+	colors, err := prominentcolor.KmeansWithAll(opts.Clusters, img, prominentcolor.ArgumentNoCropping,
+		prominentcolor.DefaultSize, []prominentcolor.ColorBackgroundMask{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract dominate color: %w", err)
+	}
+
+	total := 0
+	for _, c := range colors {
+		total += c.Cnt
+	}
+
+	palette := make([]Swatch, 0, len(colors))
+	for _, c := range colors {
+		if c.Cnt > 0 {
+			palette = append(palette, newSwatch(uint8(c.Color.R), uint8(c.Color.G), uint8(c.Color.B), float64(c.Cnt)/float64(total)))
+		}
+	}
+
+	if len(palette) == 0 {
+		return nil, errors.New("no colors found")
+	}
+
+	if opts.CenterWeighted {
+		weighByCenter(img, palette)
+	}
+
+	return palette, nil
+}
+
+// downscale returns a smaller copy of an image when its longest side exceeds
+// analysisSize.
+func downscale(img image.Image) image.Image {
+	bounds := img.Bounds()
+	longest := bounds.Dx()
+	if bounds.Dy() > longest {
+		longest = bounds.Dy()
+	}
+
+	if longest <= analysisSize {
+		return img
+	}
+
+	width := bounds.Dx() * analysisSize / longest
+	height := bounds.Dy() * analysisSize / longest
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	small := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+
+	return small
+}
+
+func newSwatch(r, g, b uint8, share float64) Swatch {
+	s := Swatch{
+		Color: fmt.Sprintf("%02X%02X%02X", r, g, b),
+		Share: share,
+		r:     float64(r) / 255,
+		g:     float64(g) / 255,
+		b:     float64(b) / 255,
+	}
+
+	max := math.Max(s.r, math.Max(s.g, s.b))
+	min := math.Min(s.r, math.Min(s.g, s.b))
+	s.Value = max
+	if max > 0 {
+		s.Saturation = (max - min) / max
+	}
+
+	return s
+}
+
+func (s *Swatch) isExtreme() bool {
+	return s.Value < darkValue || (s.Value > lightValue && s.Saturation < lightSaturation)
+}
+
+// weighByCenter replaces the share of each swatch by the portion of the image
+// closest to its color, where pixels count less the farther they are from the
+// center (i.e. the corners count a quarter of the center).
+func weighByCenter(img image.Image, palette []Swatch) {
+	bounds := img.Bounds()
+	step := bounds.Dx()
+	if bounds.Dy() > step {
+		step = bounds.Dy()
+	}
+	step /= sampleSize
+	if step < 1 {
+		step = 1
+	}
+
+	cx := float64(bounds.Min.X+bounds.Max.X) / 2
+	cy := float64(bounds.Min.Y+bounds.Max.Y) / 2
+	farthest := math.Hypot(float64(bounds.Dx())/2, float64(bounds.Dy())/2)
+
+	weights := make([]float64, len(palette))
+	total := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a == 0 {
+				continue
+			}
+
+			pr, pg, pb := float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff
+			closest := 0
+			closestDist := math.MaxFloat64
+			for i := range palette {
+				s := &palette[i]
+				dist := (pr-s.r)*(pr-s.r) + (pg-s.g)*(pg-s.g) + (pb-s.b)*(pb-s.b)
+				if dist < closestDist {
+					closest = i
+					closestDist = dist
+				}
+			}
+
+			weight := 1 - 0.75*math.Hypot(float64(x)-cx, float64(y)-cy)/farthest
+			weights[closest] += weight
+			total += weight
+		}
+	}
+
+	if total == 0 {
+		return
+	}
+
+	for i := range palette {
+		palette[i].Share = weights[i] / total
+	}
+}
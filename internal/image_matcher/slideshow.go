@@ -0,0 +1,123 @@
+package image_matcher
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// slideshow is a GNOME background that changes over time (e.g. the time of day
+// backgrounds), where each static image is shown for its duration (in seconds)
+// before a transition to the next, starting over once all have been shown.
+type slideshow struct {
+	StartTime struct {
+		Year   int `xml:"year"`
+		Month  int `xml:"month"`
+		Day    int `xml:"day"`
+		Hour   int `xml:"hour"`
+		Minute int `xml:"minute"`
+		Second int `xml:"second"`
+	} `xml:"starttime"`
+	Items []slideshowItem `xml:",any"`
+}
+
+type slideshowItem struct {
+	XMLName  xml.Name
+	Duration float64     `xml:"duration"`
+	Files    []slideFile `xml:"file"` // static
+	From     string      `xml:"from"` // transition
+	To       string      `xml:"to"`   // transition
+}
+
+// slideFile is either a path or a list of paths for different sizes
+type slideFile struct {
+	Path  string `xml:",chardata"`
+	Sizes []struct {
+		Width  int    `xml:"width,attr"`
+		Height int    `xml:"height,attr"`
+		Path   string `xml:",chardata"`
+	} `xml:"size"`
+}
+
+// ResolveSlideshow returns the image shown by a GNOME slideshow background at
+// the time provided, along with how long until a different image is shown.
+func ResolveSlideshow(pathname string, at time.Time) (string, time.Duration, error) {
+	data, err := os.ReadFile(pathname)
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to read %s: %w", pathname, err)
+	}
+
+	show := slideshow{}
+	err = xml.Unmarshal(data, &show)
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to parse slideshow %s: %w", pathname, err)
+	}
+
+	total := 0.0
+	for _, item := range show.Items {
+		total += item.Duration
+	}
+
+	if total <= 0 {
+		return "", 0, fmt.Errorf("unable to parse slideshow %s: no images with a duration", pathname)
+	}
+
+	st := show.StartTime
+	start := time.Date(st.Year, time.Month(st.Month), st.Day, st.Hour, st.Minute, st.Second, 0, time.Local)
+	elapsed := math.Mod(at.Sub(start).Seconds(), total)
+	if elapsed < 0 {
+		elapsed += total
+	}
+
+	for _, item := range show.Items {
+		if elapsed >= item.Duration {
+			elapsed -= item.Duration
+			continue
+		}
+
+		remaining := item.Duration - elapsed
+		current := ""
+		switch item.XMLName.Local {
+		case "static":
+			current = largestFile(item.Files)
+		case "transition":
+			// show whichever image is most visible
+			if elapsed < item.Duration/2 {
+				current = item.From
+				remaining = item.Duration/2 - elapsed
+			} else {
+				current = item.To
+			}
+		}
+
+		current = strings.TrimSpace(current)
+		if current == "" {
+			return "", 0, fmt.Errorf("unable to parse slideshow %s: no image in %s", pathname, item.XMLName.Local)
+		}
+
+		return current, time.Duration(math.Ceil(remaining)) * time.Second, nil
+	}
+
+	return "", 0, fmt.Errorf("unable to parse slideshow %s: no images", pathname)
+}
+
+func largestFile(files []slideFile) string {
+	best := ""
+	bestArea := -1
+	for _, file := range files {
+		if path := strings.TrimSpace(file.Path); path != "" && bestArea < 0 {
+			best = path
+		}
+
+		for _, size := range file.Sizes {
+			if area := size.Width * size.Height; area > bestArea {
+				best = size.Path
+				bestArea = area
+			}
+		}
+	}
+	return best
+}
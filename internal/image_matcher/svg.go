@@ -0,0 +1,57 @@
+package image_matcher
+
+import (
+	"compress/gzip"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// svgRasterSize is the largest width or height an SVG is drawn at, which is
+// plenty for finding its dominant color.
+const svgRasterSize = 512
+
+// loadSVG draws a (possibly gzip compressed) SVG into an image
+func loadSVG(pathname string) (image.Image, error) {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", pathname, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.ToLower(filepath.Ext(pathname)) == ".svgz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress %s: %w", pathname, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	icon, err := oksvg.ReadIconStream(r, oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %w", pathname, err)
+	}
+
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		return nil, fmt.Errorf("unable to decode %s: no size provided", pathname)
+	}
+
+	scale := svgRasterSize / math.Max(icon.ViewBox.W, icon.ViewBox.H)
+	width := int(math.Ceil(icon.ViewBox.W * scale))
+	height := int(math.Ceil(icon.ViewBox.H * scale))
+
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	icon.Draw(rasterx.NewDasher(width, height, rasterx.NewScannerGV(width, height, img, img.Bounds())), 1)
+
+	return img, nil
+}
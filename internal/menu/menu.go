@@ -20,6 +20,7 @@ import (
 
 const brightnessPrefix = "Brightness: "
 const colorPrefix = "Color: "
+const idlePrefix = "Idle: "
 
 //go:embed tray_icon_on.png
 var trayIconOn []byte
@@ -52,6 +53,7 @@ type Menu struct {
 	aboutItem      *systray.MenuItem
 	brightnessItem *systray.MenuItem
 	colorItem      *systray.MenuItem
+	idleItem       *systray.MenuItem
 
 	pauseItem *item
 	offItem   *item
@@ -114,6 +116,8 @@ func (m *Menu) Show(ctx context.Context, log *zerolog.Logger, sockPath string) e
 	m.aboutItem = m.infoItem.AddSubMenuItemCheckbox(m.AboutInfo, "", false)
 	m.brightnessItem = m.infoItem.AddSubMenuItemCheckbox(brightnessPrefix+"🯄", "", false)
 	m.colorItem = m.infoItem.AddSubMenuItemCheckbox(colorPrefix+"🯄", "", false)
+	m.idleItem = m.infoItem.AddSubMenuItem(idlePrefix+"🯄", "")
+	m.idleItem.Disable() // only informational
 
 	systray.AddSeparator()
 	m.pauseItem = &item{
@@ -318,6 +322,7 @@ func (m *Menu) update(line string) bool {
 		m.colorItem.SetTitle(colorPrefix + val)
 	case "r":
 		m.pauseItem.sysItem.Uncheck()
+		m.idleItem.SetTitle(idlePrefix + "🯄") // reported separately when idle
 
 		if m.checked != nil {
 			m.checked.sysItem.Uncheck()
@@ -334,6 +339,10 @@ func (m *Menu) update(line string) bool {
 		if m.checked == nil {
 			m.log.Warn().Str("val", val).Msg("active pattern was not found in menu items")
 		}
+	case "i":
+		m.idleItem.SetTitle(idlePrefix + title(val))
+	case "w":
+		// typing speed is not shown in the menu
 	default:
 		m.log.Warn().Str("line", line).Msg("ignoring unknown watch result key")
 	}
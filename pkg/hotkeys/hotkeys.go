@@ -0,0 +1,159 @@
+// Package hotkeys watches the keyboard for configured key chords (e.g.
+// "ctrl+alt+f9") and dispatches the command bound to each one. Keys are read
+// directly from the input device so chords work regardless of the desktop
+// environment (or lack of one).
+package hotkeys
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BitPonyLLC/huekeys/pkg/input"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/rs/zerolog"
+)
+
+// Chord is a key pressed while holding an exact set of modifiers.
+type Chord struct {
+	Modifiers []string // sorted names of the modifiers (see input.ModifierName)
+	Key       uint16
+	Name      string
+}
+
+// Hotkeys maps chords to the commands they dispatch.
+type Hotkeys struct {
+	bindings map[string]string // chord ID to command
+	names    map[string]string // chord ID to name
+}
+
+// ParseChord converts a description of modifiers and a key joined by "+" (e.g.
+// "ctrl+alt+f9") into a Chord.
+func ParseChord(name string) (*Chord, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(name)), "+")
+	chord := &Chord{Name: name, Modifiers: []string{}}
+
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if i < len(parts)-1 {
+			mod := input.ModifierName(part)
+			if mod == "" {
+				return nil, fmt.Errorf("unknown modifier in %s: %s", name, part)
+			}
+			for _, other := range chord.Modifiers {
+				if other == mod {
+					return nil, fmt.Errorf("duplicate modifier in %s: %s", name, part)
+				}
+			}
+			chord.Modifiers = append(chord.Modifiers, mod)
+			continue
+		}
+
+		code, err := input.KeyCode(part)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %s: %w", name, err)
+		}
+		chord.Key = code
+	}
+
+	sort.Strings(chord.Modifiers)
+	return chord, nil
+}
+
+// New will parse bindings of chord names to commands.
+func New(bindings map[string]string) (*Hotkeys, error) {
+	h := &Hotkeys{bindings: map[string]string{}, names: map[string]string{}}
+
+	for name, command := range bindings {
+		if strings.TrimSpace(command) == "" {
+			continue // allows disabling a binding without removing it
+		}
+
+		chord, err := ParseChord(name)
+		if err != nil {
+			return nil, err
+		}
+
+		h.bindings[chord.id()] = command
+		h.names[chord.id()] = name
+	}
+
+	return h, nil
+}
+
+// Len returns the number of chords bound to commands.
+func (h *Hotkeys) Len() int {
+	return len(h.bindings)
+}
+
+// Watch will read key presses from the keyboards chosen by the selector until
+// the context is canceled, calling dispatch with the command bound to each chord
+// pressed.
+func (h *Hotkeys) Watch(ctx context.Context, log *zerolog.Logger, selects input.Selector, dispatch func(string)) error {
+	watcher, err := input.Watch(ctx, log, selects)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Int("bindings", h.Len()).Msg("watching for hotkeys")
+
+	go func() {
+		defer util.LogRecover()
+		h.dispatchChords(ctx, log, watcher, dispatch)
+	}()
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+func (c *Chord) id() string {
+	return fmt.Sprintf("%s+%d", strings.Join(c.Modifiers, "+"), c.Key)
+}
+
+func (h *Hotkeys) dispatchChords(ctx context.Context, log *zerolog.Logger, watcher *input.Watcher, dispatch func(string)) {
+	held := map[uint16]bool{} // modifier keys currently held down
+	for {
+		var ev input.Event
+		select {
+		case <-ctx.Done():
+			return
+		case ev = <-watcher.Events:
+		}
+
+		if ev.Type != input.EvKey {
+			continue
+		}
+
+		if input.ModifierOf(ev.Code) != "" {
+			held[ev.Code] = ev.Value != input.KeyReleased
+			continue
+		}
+
+		if ev.Value != input.KeyPressed {
+			continue // ignore releases and auto-repeats
+		}
+
+		chord := &Chord{Key: ev.Code, Modifiers: []string{}}
+		seen := map[string]bool{}
+		for code, down := range held {
+			mod := input.ModifierOf(code)
+			if down && !seen[mod] {
+				seen[mod] = true
+				chord.Modifiers = append(chord.Modifiers, mod)
+			}
+		}
+		sort.Strings(chord.Modifiers)
+
+		command, ok := h.bindings[chord.id()]
+		if !ok {
+			continue
+		}
+
+		log.Info().Str("chord", h.names[chord.id()]).Str("cmd", command).Msg("hotkey pressed")
+		dispatch(command)
+	}
+}
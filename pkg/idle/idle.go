@@ -0,0 +1,257 @@
+// Package idle turns the keyboard backlight off while the user is away. Input is
+// read directly from the input devices (keyboards, touchpads, etc.) so presence
+// is detected regardless of the desktop environment (or lack of one).
+package idle
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/input"
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/rs/zerolog"
+)
+
+// Dimmer fades the backlight off after a period without any input and back on
+// with the next input.
+type Dimmer struct {
+	Timeout time.Duration
+	Fade    time.Duration
+
+	// OnSleep is called once the backlight has faded off.
+	OnSleep func()
+	// OnWake is called as the backlight begins fading back on.
+	OnWake func()
+
+	log        *zerolog.Logger
+	overlay    *keyboard.Overlay
+	mutex      sync.Mutex
+	lastInput  time.Time
+	asleep     bool
+	brightness int // what the backlight was before fading off
+}
+
+// OverlayPriority is the keyboard overlay priority used while idle. It is higher
+// than everything except toggling the keyboard off.
+const OverlayPriority = 900
+
+// DefaultFade is the amount of time taken to fade off or back on.
+const DefaultFade = 2 * time.Second
+
+// FirmwareGrace is how long input must be absent before a backlight turned off
+// outside this process is taken as the firmware's own idle timeout.
+const FirmwareGrace = 10 * time.Second
+
+// New returns a Dimmer that goes idle after the provided timeout.
+func New(timeout, fade time.Duration) *Dimmer {
+	if fade < 0 {
+		fade = DefaultFade
+	}
+
+	return &Dimmer{Timeout: timeout, Fade: fade}
+}
+
+// Watch will read input from the devices chosen by the selector until the
+// context is canceled, fading the backlight off whenever the Timeout passes
+// without any input.
+func (d *Dimmer) Watch(ctx context.Context, log *zerolog.Logger, selects input.Selector) error {
+	watcher, err := input.Watch(ctx, log, selects)
+	if err != nil {
+		return err
+	}
+
+	d.log = log
+	d.lastInput = time.Now()
+	d.overlay = keyboard.AddOverlay("idle", OverlayPriority)
+	keyboard.SetBrightnessChangeHandler(d.acceptBrightness)
+	log.Debug().Dur("timeout", d.Timeout).Dur("fade", d.Fade).Msg("watching for idle input")
+
+	go func() {
+		defer util.LogRecover()
+		defer d.stop()
+		d.process(ctx, watcher)
+	}()
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// fadeStep is the amount of time between brightness changes while fading
+const fadeStep = 50 * time.Millisecond
+
+func (d *Dimmer) process(ctx context.Context, watcher *input.Watcher) {
+	for {
+		d.mutex.Lock()
+		wait := d.Timeout - time.Since(d.lastInput)
+		asleep := d.asleep
+		d.mutex.Unlock()
+
+		if asleep || wait <= 0 {
+			wait = d.Timeout // nothing to do until input arrives
+		}
+
+		check := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			check.Stop()
+			return
+		case ev := <-watcher.Events:
+			check.Stop()
+			if ev.IsActivity() {
+				d.wake()
+			}
+		case <-check.C:
+			d.mutex.Lock()
+			idle := !d.asleep && time.Since(d.lastInput) >= d.Timeout
+			d.mutex.Unlock()
+
+			if idle {
+				d.sleep(ctx, watcher)
+			}
+		}
+	}
+}
+
+// sleep fades the backlight off, stopping early if input arrives
+func (d *Dimmer) sleep(ctx context.Context, watcher *input.Watcher) {
+	current, err := d.currentBrightness()
+	if err != nil {
+		d.log.Err(err).Msg("can't go idle")
+		return
+	}
+
+	d.log.Info().Msg("idle")
+
+	steps := int(d.Fade / fadeStep)
+	for i := 1; i <= steps; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-watcher.Events:
+			if ev.IsActivity() {
+				d.log.Debug().Msg("fade interrupted")
+				d.mutex.Lock()
+				d.lastInput = time.Now()
+				d.mutex.Unlock()
+				d.restore()
+				return
+			}
+		case <-time.After(fadeStep):
+		}
+
+		d.setBrightness(current - current*i/steps)
+	}
+
+	d.goneIdle(current)
+}
+
+// goneIdle records that the backlight is off, saving what it was before
+func (d *Dimmer) goneIdle(brightness int) {
+	d.setBrightness(0)
+
+	d.mutex.Lock()
+	d.asleep = true
+	d.brightness = brightness
+	d.mutex.Unlock()
+
+	if d.OnSleep != nil {
+		d.OnSleep()
+	}
+}
+
+// wake records input and, if the backlight is off, fades it back on
+func (d *Dimmer) wake() {
+	d.mutex.Lock()
+	d.lastInput = time.Now()
+	asleep := d.asleep
+	d.asleep = false
+	target := d.brightness
+	d.mutex.Unlock()
+
+	if !asleep {
+		return
+	}
+
+	d.log.Info().Msg("active")
+
+	if d.OnWake != nil {
+		d.OnWake()
+	}
+
+	steps := int(d.Fade / fadeStep)
+	for i := 1; i <= steps; i++ {
+		d.setBrightness(target * i / steps)
+		time.Sleep(fadeStep)
+	}
+
+	d.restore()
+}
+
+// restore removes the overlay brightness, showing whatever lies underneath it
+func (d *Dimmer) restore() {
+	err := d.overlay.ClearBrightness()
+	if err != nil {
+		d.log.Err(err).Msg("can't restore brightness")
+	}
+}
+
+func (d *Dimmer) stop() {
+	keyboard.SetBrightnessChangeHandler(nil)
+
+	d.mutex.Lock()
+	asleep := d.asleep
+	d.asleep = false
+	d.mutex.Unlock()
+
+	if asleep && d.OnWake != nil {
+		d.OnWake()
+	}
+
+	d.overlay.Remove()
+}
+
+// acceptBrightness is consulted by the keyboard monitor when the brightness is
+// changed outside this process. The firmware's own idle timeout turns the
+// backlight off, so rather than fighting it, go idle right away.
+func (d *Dimmer) acceptBrightness(want, have string) bool {
+	d.mutex.Lock()
+	asleep := d.asleep
+	absent := time.Since(d.lastInput) >= FirmwareGrace
+	d.mutex.Unlock()
+
+	if have != "0" || asleep || !absent {
+		return false
+	}
+
+	// the firmware already turned it off: fade back on to what was wanted
+	before, err := strconv.Atoi(want)
+	if err != nil {
+		return false
+	}
+
+	d.log.Info().Msg("idle (firmware timeout)")
+	d.goneIdle(before)
+	return true
+}
+
+func (d *Dimmer) currentBrightness() (int, error) {
+	current, err := keyboard.GetCurrentBrightness()
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(current)
+}
+
+func (d *Dimmer) setBrightness(brightness int) {
+	err := d.overlay.SetBrightness(strconv.Itoa(brightness))
+	if err != nil {
+		d.log.Err(err).Msg("can't set brightness")
+	}
+}
@@ -0,0 +1,130 @@
+// Package input provides helpers for reading events from Linux input (evdev)
+// devices like keyboards.
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Event is a single event reported by an input device.
+// https://www.kernel.org/doc/html/latest/input/input.html#event-interface
+type Event struct {
+	Time  time.Time
+	Type  uint16 // the kind of event being reported (e.g. EvKey)
+	Code  uint16 // in the context of EvKey, the key that was pressed
+	Value int32  // the state of the event being reported (on/off, pressed/unpressed, etc.)
+}
+
+// Device is an open input events device.
+type Device struct {
+	Path string
+
+	file *os.File
+}
+
+// Event types and values.
+// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L34-L51
+const (
+	EvKey = 0x01
+	EvRel = 0x02
+	EvAbs = 0x03
+	EvLED = 0x11
+
+	KeyReleased = 0
+	KeyPressed  = 1
+	KeyRepeated = 2
+)
+
+// LED codes reported with EvLED events (the value is 1 when lit).
+// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L903-L915
+const (
+	LedNumLock    = 0x00
+	LedCapsLock   = 0x01
+	LedScrollLock = 0x02
+)
+
+// Open will open the input events device at the provided path (e.g.
+// "/dev/input/event3").
+func Open(path string) (*Device, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open input events device (%s): %w", path, err)
+	}
+
+	return &Device{Path: path, file: f}, nil
+}
+
+// Read blocks until the next event is available from the device.
+func (d *Device) Read() (Event, error) {
+	// https://janczer.github.io/work-with-dev-input/
+	buf := make([]byte, eventSize)
+	_, err := io.ReadFull(d.file, buf)
+	if err != nil {
+		return Event{}, fmt.Errorf("can't read input events device (%s): %w", d.Path, err)
+	}
+
+	sec := binary.LittleEndian.Uint64(buf[0:8])
+	usec := binary.LittleEndian.Uint64(buf[8:16])
+
+	ev := Event{
+		Time: time.Unix(int64(sec), int64(usec)*1000),
+		Type: binary.LittleEndian.Uint16(buf[16:18]),
+		Code: binary.LittleEndian.Uint16(buf[18:20]),
+	}
+
+	binary.Read(bytes.NewReader(buf[20:]), binary.LittleEndian, &ev.Value)
+	return ev, nil
+}
+
+// Close will close the device, interrupting any blocked Read.
+func (d *Device) Close() error {
+	return d.file.Close()
+}
+
+// IsKeyPress determines if the event is reporting that a key was pressed.
+func (ev Event) IsKeyPress() bool {
+	return ev.Type == EvKey && ev.Value == KeyPressed
+}
+
+// IsActivity determines if the event shows someone is present (i.e. a key
+// press or pointer movement, rather than an LED change).
+func (ev Event) IsActivity() bool {
+	return ev.Type == EvKey || ev.Type == EvRel || ev.Type == EvAbs
+}
+
+// IsCorrection determines if the key code is one used to correct mistakes
+// (backspace and delete).
+func IsCorrection(code uint16) bool {
+	// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L79
+	return code == keyBackspace || code == keyDelete
+}
+
+// IsPrintable determines if the key code is one that produces a visible
+// character (letters, numbers, punctuation, and space).
+func IsPrintable(code uint16) bool {
+	// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L64
+	return (1 < code && code < 14) ||
+		(15 < code && code < 29) ||
+		(29 < code && code < 42) ||
+		(42 < code && code < 54) ||
+		(code == 57)
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// struct input_event on 64-bit systems: timeval (16 bytes), type, code, value
+const eventSize = 24
+
+const (
+	keyBackspace = 14
+	keyDelete    = 111
+)
+
+var handlerEventRE = regexp.MustCompile(`[= ](event\d+)( |$)`)
@@ -0,0 +1,76 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Modifier names reported by ModifierOf.
+const (
+	CtrlModifier  = "ctrl"
+	AltModifier   = "alt"
+	ShiftModifier = "shift"
+	MetaModifier  = "meta"
+)
+
+// KeyCode returns the code of a key by its name (e.g. "a", "f9", "space", or
+// "pagedown"), ignoring case.
+func KeyCode(name string) (uint16, error) {
+	code, ok := keyCodes[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown key: %s", name)
+	}
+	return code, nil
+}
+
+// ModifierOf returns the name of the modifier the key code represents (either
+// the left or right version) or an empty string if it is not a modifier.
+func ModifierOf(code uint16) string {
+	return modifierCodes[code]
+}
+
+// ModifierName returns the canonical name of a modifier (e.g. "control" is
+// "ctrl") or an empty string if the name is not a modifier.
+func ModifierName(name string) string {
+	return modifierNames[strings.ToLower(name)]
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L64
+var keyCodes = map[string]uint16{
+	"esc": 1, "1": 2, "2": 3, "3": 4, "4": 5, "5": 6, "6": 7, "7": 8, "8": 9, "9": 10, "0": 11,
+	"minus": 12, "equal": 13, "backspace": 14, "tab": 15,
+	"q": 16, "w": 17, "e": 18, "r": 19, "t": 20, "y": 21, "u": 22, "i": 23, "o": 24, "p": 25,
+	"leftbrace": 26, "rightbrace": 27, "enter": 28,
+	"a": 30, "s": 31, "d": 32, "f": 33, "g": 34, "h": 35, "j": 36, "k": 37, "l": 38,
+	"semicolon": 39, "apostrophe": 40, "grave": 41, "backslash": 43,
+	"z": 44, "x": 45, "c": 46, "v": 47, "b": 48, "n": 49, "m": 50,
+	"comma": 51, "dot": 52, "slash": 53, "space": 57, "capslock": 58,
+	"f1": 59, "f2": 60, "f3": 61, "f4": 62, "f5": 63, "f6": 64, "f7": 65, "f8": 66, "f9": 67, "f10": 68,
+	"numlock": 69, "scrolllock": 70, "f11": 87, "f12": 88, "print": 99,
+	"home": 102, "up": 103, "pageup": 104, "left": 105, "right": 106, "end": 107, "down": 108,
+	"pagedown": 109, "insert": 110, "delete": 111, "pause": 119,
+}
+
+var modifierCodes = map[uint16]string{
+	29:  CtrlModifier,
+	97:  CtrlModifier,
+	42:  ShiftModifier,
+	54:  ShiftModifier,
+	56:  AltModifier,
+	100: AltModifier,
+	125: MetaModifier,
+	126: MetaModifier,
+}
+
+var modifierNames = map[string]string{
+	"ctrl":    CtrlModifier,
+	"control": CtrlModifier,
+	"alt":     AltModifier,
+	"shift":   ShiftModifier,
+	"meta":    MetaModifier,
+	"super":   MetaModifier,
+	"win":     MetaModifier,
+}
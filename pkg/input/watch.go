@@ -0,0 +1,304 @@
+package input
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// DeviceInfo describes an input device known to the kernel.
+type DeviceInfo struct {
+	Name    string
+	EventID string // e.g. "event3"
+}
+
+// Selector determines which input devices are used.
+type Selector func(DeviceInfo) bool
+
+// Watcher aggregates events from all input devices chosen by a Selector,
+// including those added after it starts (e.g. USB or Bluetooth keyboards).
+type Watcher struct {
+	Events chan Event
+
+	log     *zerolog.Logger
+	selects Selector
+	mutex   sync.Mutex
+	devices map[string]*Device // by event ID
+}
+
+// DevicesDir is where the input devices are found.
+const DevicesDir = "/dev/input"
+
+// DefaultDeviceMatch is used to select devices when none are specified: any
+// device with a name that looks like a keyboard.
+const DefaultDeviceMatch = "(?i)keyboard"
+
+// hotplugSettleDelay allows the kernel to finish registering a new device
+const hotplugSettleDelay = 250 * time.Millisecond
+
+// ListDevices returns all input devices that report events.
+func ListDevices() ([]DeviceInfo, error) {
+	f, err := os.Open("/proc/bus/input/devices")
+	if err != nil {
+		return nil, fmt.Errorf("can't open input devices list: %w", err)
+	}
+	defer f.Close()
+
+	devices := []DeviceInfo{}
+	info := DeviceInfo{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			info = DeviceInfo{}
+			continue
+		}
+
+		switch line[0] {
+		case 'N':
+			info.Name = strings.Trim(strings.TrimPrefix(line, "N: Name="), `"`)
+		case 'H':
+			match := handlerEventRE.FindStringSubmatch(line)
+			if match != nil {
+				info.EventID = match[1]
+				devices = append(devices, info)
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+// NewSelector returns a Selector for devices matching any of the specs
+// provided. Each spec may be an event ID (e.g. "event3"), a path to a device
+// (e.g. "/dev/input/by-id/usb-...-event-kbd"), or a regular expression matched
+// against device names. When no specs are provided, DefaultDeviceMatch is used.
+func NewSelector(specs ...string) (Selector, error) {
+	paths := []string{}
+	ids := map[string]bool{}
+	names := []*regexp.Regexp{}
+
+	for _, spec := range specs {
+		switch {
+		case spec == "":
+			continue
+		case strings.HasPrefix(spec, "/"):
+			paths = append(paths, spec)
+		case eventIDRE.MatchString(spec):
+			ids[spec] = true
+		default:
+			re, err := regexp.Compile(spec)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse input device match %s: %w", spec, err)
+			}
+			names = append(names, re)
+		}
+	}
+
+	if len(paths) == 0 && len(ids) == 0 && len(names) == 0 {
+		names = append(names, regexp.MustCompile(DefaultDeviceMatch))
+	}
+
+	return func(info DeviceInfo) bool {
+		if ids[info.EventID] {
+			return true
+		}
+
+		for _, path := range paths {
+			// symlinks (e.g. by-id) come and go as devices are plugged in
+			resolved, err := filepath.EvalSymlinks(path)
+			if err == nil && filepath.Base(resolved) == info.EventID {
+				return true
+			}
+		}
+
+		for _, re := range names {
+			if re.MatchString(info.Name) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// Watch will open all devices chosen by the selector and send their events to
+// the Watcher's Events channel until the context is canceled. Devices that are
+// removed are dropped and new ones are opened as they appear.
+func Watch(ctx context.Context, log *zerolog.Logger, selects Selector) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("can't create input device watcher: %w", err)
+	}
+
+	err = fsw.Add(DevicesDir)
+	if err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("can't watch %s: %w", DevicesDir, err)
+	}
+
+	w := &Watcher{
+		Events:  make(chan Event, 64),
+		log:     log,
+		selects: selects,
+		devices: map[string]*Device{},
+	}
+
+	err = w.scan(ctx)
+	if err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	if w.Len() == 0 {
+		log.Warn().Msg("no input devices found: waiting for one to be added")
+	}
+
+	go func() {
+		defer util.LogRecover()
+		defer fsw.Close()
+		defer w.closeAll()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-fsw.Errors:
+				log.Warn().Err(err).Msg("input device watcher failed")
+			case ev := <-fsw.Events:
+				if ev.Op&fsnotify.Create == 0 || !eventIDRE.MatchString(filepath.Base(ev.Name)) {
+					continue
+				}
+
+				// give the kernel a moment to register the device's details
+				time.Sleep(hotplugSettleDelay)
+
+				err := w.scan(ctx)
+				if err != nil {
+					log.Warn().Err(err).Msg("can't scan input devices")
+				}
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// Len returns the number of devices currently open.
+func (w *Watcher) Len() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return len(w.devices)
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+var eventIDRE = regexp.MustCompile(`^event\d+$`)
+
+func (w *Watcher) scan(ctx context.Context) error {
+	infos, err := ListDevices()
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, info := range infos {
+		path := filepath.Join(DevicesDir, info.EventID)
+
+		if open := w.devices[info.EventID]; open != nil {
+			if open.isFile(path) {
+				continue
+			}
+
+			// removed and added again with the same event ID before its reader
+			// noticed: the file open is no longer the device at that path
+			w.log.Info().Str("name", info.Name).Str("device", path).Msg("input device replaced")
+			delete(w.devices, info.EventID)
+			open.Close()
+		}
+
+		if !w.selects(info) {
+			continue
+		}
+
+		device, err := Open(path)
+		if err != nil {
+			w.log.Warn().Err(err).Str("name", info.Name).Msg("can't open input device")
+			continue
+		}
+
+		w.log.Info().Str("name", info.Name).Str("device", device.Path).Msg("input device opened")
+		w.devices[info.EventID] = device
+		go w.read(ctx, info, device)
+	}
+
+	return nil
+}
+
+func (w *Watcher) read(ctx context.Context, info DeviceInfo, device *Device) {
+	defer util.LogRecover()
+
+	for {
+		ev, err := device.Read()
+		if err != nil {
+			w.mutex.Lock()
+			if w.devices[info.EventID] == device {
+				delete(w.devices, info.EventID)
+			}
+			w.mutex.Unlock()
+			device.Close()
+
+			if ctx.Err() == nil {
+				w.log.Info().Err(err).Str("name", info.Name).Msg("input device removed")
+			}
+			return
+		}
+
+		select {
+		case w.Events <- ev:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher) closeAll() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for id, device := range w.devices {
+		device.Close()
+		delete(w.devices, id)
+	}
+}
+
+// isFile determines if the device is still the one found at the path
+func (d *Device) isFile(path string) bool {
+	openInfo, err := d.file.Stat()
+	if err != nil {
+		return false
+	}
+
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(openInfo, pathInfo)
+}
@@ -2,12 +2,15 @@ package ipc
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"strings"
 
 	"github.com/BitPonyLLC/huekeys/pkg/util"
 
 	"github.com/mattn/go-shellwords"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 type acceptedConn struct {
@@ -44,13 +47,28 @@ func (ac *acceptedConn) processCommand(parent *IPCServer) {
 	line = strings.TrimSpace(line)
 	clog := parent.log.With().Str("cmd", line).Logger()
 
+	peer, err := peerOf(ac.conn)
+	if err != nil {
+		clog.Err(err).Msg("refusing command")
+		errWriter.Writeln("unable to identify client")
+		return
+	}
+
+	clog = clog.With().Int("uid", peer.Uid).Int("pid", peer.Pid).Logger()
+	ctx := context.WithValue(parent.ctx, peerKey{}, peer)
+
 	args, err := shellwords.Parse(line)
 	if err != nil {
 		errWriter.Writeln("unable to parse command: %s", line)
 	} else {
 		clog.Debug().Msg("executing")
+		if target, _, err := parent.cmd.Find(args); err == nil {
+			resetFlags(target)
+			// commands keep the first context they were given otherwise
+			target.SetContext(ctx)
+		}
 		parent.cmd.SetArgs(args)
-		err = parent.cmd.ExecuteContext(parent.ctx)
+		err = parent.cmd.ExecuteContext(ctx)
 		if err != nil {
 			clog.Err(err).Msg("command failed")
 		}
@@ -64,3 +82,27 @@ func (ac *acceptedConn) processCommand(parent *IPCServer) {
 		clog.Err(errWriter.err).Msg("error writer failed")
 	}
 }
+
+// resetFlags restores the default values of a command's flags before it is
+// executed again. The same command is reused for every client, so it would
+// otherwise retain the flags set by previous clients (and values of slice flags,
+// i.e. flags that may be repeated, would be appended to theirs).
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			def := []string{}
+			if trimmed := strings.Trim(f.DefValue, "[]"); trimmed != "" {
+				def = strings.Split(trimmed, ",")
+			}
+			sv.Replace(def)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+
+		f.Changed = false
+	})
+}
@@ -0,0 +1,59 @@
+package ipc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Peer describes the process that sent a command over the socket.
+type Peer struct {
+	Pid int
+	Uid int
+	Gid int
+}
+
+type peerKey struct{}
+
+// PeerFrom returns the process that sent the command being executed with the
+// provided context, or nil if the command wasn't received over the socket.
+func PeerFrom(ctx context.Context) *Peer {
+	if ctx == nil {
+		return nil
+	}
+
+	peer, _ := ctx.Value(peerKey{}).(*Peer)
+	return peer
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// peerOf asks the kernel who is on the other end of a connection (i.e. this
+// can't be spoofed by the client).
+func peerOf(conn net.Conn) (*Peer, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("not a unix connection")
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get peer credentials: %w", err)
+	}
+
+	return &Peer{Pid: int(cred.Pid), Uid: int(cred.Uid), Gid: int(cred.Gid)}, nil
+}
@@ -8,6 +8,7 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"sort"
@@ -30,6 +31,7 @@ type RGBColor struct {
 // is changed.
 type ChangeEvent struct {
 	Color      string
+	Zone       string // only set when Color was changed for a single zone
 	Brightness string
 }
 
@@ -86,6 +88,116 @@ func (c RGBColor) GetColorInHex() string {
 	return fmt.Sprintf(rgbHexFormat, c.Red, c.Green, c.Blue)
 }
 
+// ParseColor converts a color name or hex code into its RGB values.
+func ParseColor(color string) (RGBColor, error) {
+	if presetColor, exists := presetColors[strings.ToLower(color)]; exists {
+		return presetColor, nil
+	}
+
+	rgb := RGBColor{}
+	hex := strings.TrimPrefix(color, "#")
+	n, err := fmt.Sscanf(hex, rgbHexFormat, &rgb.Red, &rgb.Green, &rgb.Blue)
+	if err != nil || n != 3 || len(hex) != 6 {
+		return rgb, fmt.Errorf("unknown color: %s", color)
+	}
+
+	return rgb, nil
+}
+
+// Blend returns the color that is the given fraction (0.0 to 1.0) of the way
+// from this color to the other color.
+func (c RGBColor) Blend(other RGBColor, fraction float64) RGBColor {
+	mix := func(a, b int) int {
+		return a + int(math.Round(float64(b-a)*fraction))
+	}
+	return RGBColor{
+		Red:   mix(c.Red, other.Red),
+		Green: mix(c.Green, other.Green),
+		Blue:  mix(c.Blue, other.Blue),
+	}
+}
+
+// BlendPerceptual is like Blend but mixes the colors in the OKLab color space so
+// that the steps between them appear evenly spaced to the human eye.
+func (c RGBColor) BlendPerceptual(other RGBColor, fraction float64) RGBColor {
+	l1, a1, b1 := c.okLab()
+	l2, a2, b2 := other.okLab()
+	mix := func(x, y float64) float64 {
+		return x + (y-x)*fraction
+	}
+	return fromOKLab(mix(l1, l2), mix(a1, a2), mix(b1, b2))
+}
+
+// HSV returns the hue (0 to 360), saturation (0.0 to 1.0), and value (0.0 to
+// 1.0) of this color.
+func (c RGBColor) HSV() (float64, float64, float64) {
+	r := float64(c.Red) / 255
+	g := float64(c.Green) / 255
+	b := float64(c.Blue) / 255
+
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case max == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case max == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+
+	if h < 0 {
+		h += 360
+	}
+
+	var s float64
+	if max > 0 {
+		s = delta / max
+	}
+
+	return h, s, max
+}
+
+// FromHSV converts a hue (0 to 360), saturation (0.0 to 1.0), and value (0.0 to
+// 1.0) into a color.
+func FromHSV(h, s, v float64) RGBColor {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return RGBColor{
+		Red:   int(math.Round((r + m) * 255)),
+		Green: int(math.Round((g + m) * 255)),
+		Blue:  int(math.Round((b + m) * 255)),
+	}
+}
+
 // EachPresetColor iterates all the loaded color names and invokes the provided
 // callback for each one.
 func EachPresetColor(cb func(name, value string)) {
@@ -100,69 +212,77 @@ func EachPresetColor(cb func(name, value string)) {
 	}
 }
 
-// ColorFileHandler writes a string to colorFiles.
+// ColorFileHandler writes a string to colorFiles. If an Overlay is currently
+// providing a color, the value is remembered and written once the Overlay is
+// removed.
 func ColorFileHandler(color string) error {
-	sys := getSysPath()
-	if sys.Path == "" {
-		return errors.New("can't get a valid sysfs leds path")
-	}
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
 
-	monitoredColor.Store(color)
-
-	if presetColor, exists := presetColors[color]; exists {
-		color = presetColor.GetColorInHex()
-	} else if color == RandomColor {
-		color = getRandomColor()
+	baseColor = color
+	baseZoneColors = nil
+	if topOverlayColor() != "" {
+		return nil
 	}
 
-	for _, file := range sys.Files {
-		if file == "" {
-			continue
-		}
+	err := writeColor(color)
+	if err != nil {
+		return err
+	}
 
-		p := fmt.Sprintf("%v/%v", sys.Path, file)
-		fh, err := os.OpenFile(p, os.O_RDWR, 0755)
-		if err != nil {
-			return fmt.Errorf("can't open %s: %w", sys.Path, err)
-		}
-		defer fh.Close()
+	return writeZoneOverlays()
+}
 
-		_, err = fh.WriteString(color)
-		if err != nil {
-			return fmt.Errorf("can't write color to %s: %w", sys.Path, err)
-		}
+// ZoneColorFileHandler writes a color to a single zone of the keyboard (see
+// GetZones). If an Overlay is currently providing a color, the value is
+// remembered and written once the Overlay is removed.
+func ZoneColorFileHandler(zone, color string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
 
-		log.Trace().Str("file", p).Str("color", color).Msg("set")
+	file := zoneFile(zone)
+	if file == "" {
+		return fmt.Errorf("unknown keyboard zone: %s (expected one of %s)", zone, strings.Join(GetZones(), ", "))
 	}
 
-	Events.Emit(ChangeEvent{Color: color})
-	return nil
-}
-
-// BrightnessFileHandler writes a hex value to brightness and returns the bytes written.
-func BrightnessFileHandler(brightness string) error {
-	sys := getSysPath()
-	if sys.Path == "" {
-		return errors.New("can't get a valid sysfs leds path")
+	if baseZoneColors == nil {
+		baseZoneColors = map[string]string{}
 	}
 
-	monitoredBrightness.Store(brightness)
+	baseZoneColors[zone] = color
+	if top, _ := topOverlayZoneColor(zone); top != "" {
+		return nil
+	}
 
-	p := fmt.Sprintf("%v/brightness", sys.Path)
+	return writeZoneColor(zone, color)
+}
 
-	f, err := os.OpenFile(p, os.O_RDWR, 0755)
-	if err != nil {
-		return fmt.Errorf("can't open brightness file (%s): %w", p, err)
+// GetZones returns the names of the color zones available on the keyboard
+// (e.g. "left", "center", "right", and "extra" or only "main" for keyboards
+// with a single zone).
+func GetZones() []string {
+	zones := []string{}
+	for _, file := range getSysPath().Files {
+		if file != "" {
+			zones = append(zones, fileZone(file))
+		}
 	}
-	defer f.Close()
+	return zones
+}
 
-	_, err = f.WriteString(brightness)
-	if err != nil {
-		return fmt.Errorf("can't set brightness value (%s): %w", p, err)
+// BrightnessFileHandler writes a hex value to brightness. If an Overlay is
+// currently providing a brightness, the value is remembered and written once the
+// Overlay is removed.
+func BrightnessFileHandler(brightness string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	baseBrightness = brightness
+	if topOverlayBrightness() != "" {
+		return nil
 	}
 
-	Events.Emit(ChangeEvent{Brightness: brightness})
-	return nil
+	return writeBrightness(brightness)
 }
 
 // GetCurrentColors reads the color values currently set and returns their values.
@@ -270,6 +390,161 @@ func getSysPath() sysPath {
 	return ret
 }
 
+func writeColor(color string) error {
+	sys := getSysPath()
+	if sys.Path == "" {
+		return errors.New("can't get a valid sysfs leds path")
+	}
+
+	monitoredColor.Store(color)
+
+	if presetColor, exists := presetColors[color]; exists {
+		color = presetColor.GetColorInHex()
+	} else if color == RandomColor {
+		color = getRandomColor()
+	}
+
+	for _, file := range sys.Files {
+		if file == "" {
+			continue
+		}
+
+		p := fmt.Sprintf("%v/%v", sys.Path, file)
+		fh, err := os.OpenFile(p, os.O_RDWR, 0755)
+		if err != nil {
+			return fmt.Errorf("can't open %s: %w", sys.Path, err)
+		}
+		defer fh.Close()
+
+		_, err = fh.WriteString(color)
+		if err != nil {
+			return fmt.Errorf("can't write color to %s: %w", sys.Path, err)
+		}
+
+		log.Trace().Str("file", p).Str("color", color).Msg("set")
+	}
+
+	Events.Emit(ChangeEvent{Color: color})
+	return nil
+}
+
+func writeZoneColor(zone, color string) error {
+	sys := getSysPath()
+	if sys.Path == "" {
+		return errors.New("can't get a valid sysfs leds path")
+	}
+
+	// the monitor only knows how to preserve a single color for all zones
+	monitoredColor.Store("")
+
+	if presetColor, exists := presetColors[color]; exists {
+		color = presetColor.GetColorInHex()
+	} else if color == RandomColor {
+		color = getRandomColor()
+	}
+
+	p := fmt.Sprintf("%v/%v", sys.Path, zoneFile(zone))
+	fh, err := os.OpenFile(p, os.O_RDWR, 0755)
+	if err != nil {
+		return fmt.Errorf("can't open %s: %w", p, err)
+	}
+	defer fh.Close()
+
+	_, err = fh.WriteString(color)
+	if err != nil {
+		return fmt.Errorf("can't write color to %s: %w", p, err)
+	}
+
+	log.Trace().Str("file", p).Str("color", color).Msg("set")
+
+	Events.Emit(ChangeEvent{Color: color, Zone: zone})
+	return nil
+}
+
+func zoneFile(zone string) string {
+	for _, file := range getSysPath().Files {
+		if file != "" && fileZone(file) == zone {
+			return file
+		}
+	}
+	return ""
+}
+
+func fileZone(file string) string {
+	if file == "color" {
+		return "main"
+	}
+	return strings.TrimPrefix(file, "color_")
+}
+
+func writeBrightness(brightness string) error {
+	sys := getSysPath()
+	if sys.Path == "" {
+		return errors.New("can't get a valid sysfs leds path")
+	}
+
+	monitoredBrightness.Store(brightness)
+
+	p := fmt.Sprintf("%v/brightness", sys.Path)
+
+	f, err := os.OpenFile(p, os.O_RDWR, 0755)
+	if err != nil {
+		return fmt.Errorf("can't open brightness file (%s): %w", p, err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(brightness)
+	if err != nil {
+		return fmt.Errorf("can't set brightness value (%s): %w", p, err)
+	}
+
+	Events.Emit(ChangeEvent{Brightness: brightness})
+	return nil
+}
+
+// https://bottosson.github.io/posts/oklab/
+func (c RGBColor) okLab() (float64, float64, float64) {
+	toLinear := func(v int) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+
+	r, g, b := toLinear(c.Red), toLinear(c.Green), toLinear(c.Blue)
+
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	return 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s
+}
+
+func fromOKLab(lightness, a, b float64) RGBColor {
+	l := lightness + 0.3963377774*a + 0.2158037573*b
+	m := lightness - 0.1055613458*a - 0.0638541728*b
+	s := lightness - 0.0894841775*a - 1.2914855480*b
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	fromLinear := func(v float64) int {
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		return int(math.Round(255 * math.Max(0, math.Min(1, v))))
+	}
+
+	return RGBColor{
+		Red:   fromLinear(4.0767416621*l - 3.3077115913*m + 0.2309699292*s),
+		Green: fromLinear(-1.2684380046*l + 2.6097574011*m - 0.3413193965*s),
+		Blue:  fromLinear(-0.0041960863*l - 0.7034186147*m + 1.7076147010*s),
+	}
+}
+
 func getColorOf(color string) string {
 	var red int
 	var green int
@@ -24,9 +24,19 @@ func StartMonitor(ctx context.Context, delay time.Duration) {
 	}
 }
 
+// SetBrightnessChangeHandler establishes a function the monitor consults before
+// resetting a brightness changed outside this process (e.g. by the firmware's
+// own idle timeout). The handler is provided the brightness wanted and the one
+// found. When the handler returns true, the change is accepted.
+func SetBrightnessChangeHandler(handler func(want, have string) bool) {
+	brightnessChangeHandler.Store(handler)
+}
+
 //--------------------------------------------------------------------------------
 // private
 
+var brightnessChangeHandler atomic.Value
+
 var monitorMutex sync.Mutex
 var monitorCtx atomic.Value
 var monitorDelay atomic.Duration
@@ -57,7 +67,7 @@ func monitor() {
 			for _, c := range cc {
 				if color != c {
 					log.Trace().Str("want", color).Str("have", c).Msg("resetting color")
-					err = ColorFileHandler(color)
+					err = rewrite(writeColor, color)
 					if err != nil {
 						log.Err(err).Msg("monitor")
 						return
@@ -76,9 +86,14 @@ func monitor() {
 				return
 			}
 
+			if brightness != cb && acceptBrightness(brightness, cb) {
+				log.Trace().Str("want", brightness).Str("have", cb).Msg("accepting brightness")
+				continue
+			}
+
 			if brightness != cb {
 				log.Trace().Str("want", brightness).Str("have", cb).Msg("resetting brightness")
-				err = BrightnessFileHandler(brightness)
+				err = rewrite(writeBrightness, brightness)
 				if err != nil {
 					log.Err(err).Msg("monitor")
 					return
@@ -87,3 +102,16 @@ func monitor() {
 		}
 	}
 }
+
+// rewrite resets a monitored value without changing what is remembered as being
+// underneath any active overlays
+func rewrite(write func(string) error, value string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	return write(value)
+}
+
+func acceptBrightness(want, have string) bool {
+	handler, _ := brightnessChangeHandler.Load().(func(string, string) bool)
+	return handler != nil && handler(want, have)
+}
@@ -0,0 +1,360 @@
+package keyboard
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Overlay temporarily takes over the color and/or brightness of the keyboard
+// without losing what was set underneath it (e.g. by a running pattern). Values
+// set through ColorFileHandler or BrightnessFileHandler while an Overlay is
+// active are remembered and restored when the Overlay is removed. When more than
+// one Overlay is active, the one with the highest priority wins. An Overlay may
+// also provide colors for individual zones (see GetZones), leaving the others
+// showing whatever lies underneath.
+type Overlay struct {
+	Name     string
+	Priority int
+
+	color      string
+	zoneColors map[string]string
+	brightness string
+}
+
+// AddOverlay registers a new Overlay. It has no effect on the keyboard until a
+// color or brightness is set on it.
+func AddOverlay(name string, priority int) *Overlay {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	o := &Overlay{Name: name, Priority: priority}
+	overlays = append(overlays, o)
+	sort.SliceStable(overlays, func(i, j int) bool {
+		return overlays[i].Priority > overlays[j].Priority
+	})
+
+	return o
+}
+
+// SetColor will change the color shown while this Overlay is active. The color
+// is only written to the keyboard if no higher priority Overlay has a color.
+func (o *Overlay) SetColor(color string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	if baseColor == "" {
+		captureBaseColor()
+	}
+
+	o.color = color
+	if topOverlayColor() != color {
+		return nil
+	}
+
+	err := writeColor(color)
+	if err != nil {
+		return err
+	}
+
+	return writeZoneOverlays()
+}
+
+// SetZoneColor will change the color shown on a single zone while this Overlay
+// is active. The color is only written to the keyboard if no higher priority
+// Overlay has a color for the zone.
+func (o *Overlay) SetZoneColor(zone, color string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	if zoneFile(zone) == "" {
+		return fmt.Errorf("unknown keyboard zone: %s (expected one of %s)", zone, strings.Join(GetZones(), ", "))
+	}
+
+	if baseColor == "" && baseZoneColors == nil {
+		captureBaseColor()
+	}
+
+	if o.zoneColors == nil {
+		o.zoneColors = map[string]string{}
+	}
+
+	o.zoneColors[zone] = color
+	if top, _ := topOverlayZoneColor(zone); top != color {
+		return nil
+	}
+
+	return writeZoneColor(zone, color)
+}
+
+// ClearZoneColor will stop this Overlay from providing a color for a single
+// zone, restoring whatever lies underneath it.
+func (o *Overlay) ClearZoneColor(zone string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	return o.clearZone(zone)
+}
+
+// SetBrightness will change the brightness used while this Overlay is active.
+// The brightness is only written to the keyboard if no higher priority Overlay
+// has a brightness.
+func (o *Overlay) SetBrightness(brightness string) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	if baseBrightness == "" {
+		captureBaseBrightness()
+	}
+
+	o.brightness = brightness
+	if topOverlayBrightness() != brightness {
+		return nil
+	}
+
+	return writeBrightness(brightness)
+}
+
+// ClearColor will stop this Overlay from providing a color, restoring whatever
+// lies underneath it.
+func (o *Overlay) ClearColor() error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	err := o.clear(true, false)
+	if err != nil {
+		return err
+	}
+
+	for zone := range o.zoneColors {
+		err = o.clearZone(zone)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClearBrightness will stop this Overlay from providing a brightness, restoring
+// whatever lies underneath it.
+func (o *Overlay) ClearBrightness() error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	return o.clear(false, true)
+}
+
+// Remove unregisters the Overlay and restores the color and brightness that lie
+// underneath it.
+func (o *Overlay) Remove() error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	err := o.clear(true, true)
+	for zone := range o.zoneColors {
+		if zoneErr := o.clearZone(zone); err == nil {
+			err = zoneErr
+		}
+	}
+
+	for i, other := range overlays {
+		if other == o {
+			overlays = append(overlays[:i], overlays[i+1:]...)
+			break
+		}
+	}
+
+	return err
+}
+
+// GetBaseBrightness returns the brightness underneath any Overlay (i.e. what
+// will be restored once the Overlays are removed), or the current brightness
+// when no Overlay is providing one.
+func GetBaseBrightness() (string, error) {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	if topOverlayBrightness() != "" && baseBrightness != "" {
+		return baseBrightness, nil
+	}
+
+	return GetCurrentBrightness()
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+var writeMutex sync.Mutex
+var overlays []*Overlay
+var baseColor string
+var baseZoneColors map[string]string
+var baseBrightness string
+
+func (o *Overlay) clear(color, brightness bool) error {
+	var colorErr, brightnessErr error
+
+	if color && o.color != "" {
+		before := topOverlayColor()
+		o.color = ""
+		after := topOverlayColor()
+		if after == "" {
+			after = baseColor
+		}
+		if after != "" && after != before {
+			colorErr = writeColor(after)
+		}
+		if after == baseColor && colorErr == nil {
+			for zone, zoneColor := range baseZoneColors {
+				colorErr = writeZoneColor(zone, zoneColor)
+				if colorErr != nil {
+					break
+				}
+			}
+		}
+		if colorErr == nil {
+			colorErr = writeZoneOverlays()
+		}
+	}
+
+	if brightness && o.brightness != "" {
+		before := topOverlayBrightness()
+		o.brightness = ""
+		after := topOverlayBrightness()
+		if after == "" {
+			after = baseBrightness
+		}
+		if after != "" && after != before {
+			brightnessErr = writeBrightness(after)
+		}
+	}
+
+	if colorErr != nil {
+		return colorErr
+	}
+
+	return brightnessErr
+}
+
+// expects writeMutex to be held
+func topOverlayColor() string {
+	for _, o := range overlays {
+		if o.color != "" {
+			return o.color
+		}
+	}
+	return ""
+}
+
+// expects writeMutex to be held
+func (o *Overlay) clearZone(zone string) error {
+	if o.zoneColors[zone] == "" {
+		return nil
+	}
+
+	before, _ := topOverlayZoneColor(zone)
+	delete(o.zoneColors, zone)
+
+	after, _ := topOverlayZoneColor(zone)
+	if after == "" {
+		after = baseZoneColors[zone]
+	}
+	if after == "" {
+		after = baseColor
+	}
+	if after == "" || after == before {
+		return nil
+	}
+
+	return writeZoneColor(zone, after)
+}
+
+// topOverlayZoneColor returns the color a zone shows from the highest priority
+// Overlay providing one (either for the whole keyboard or only for the zone),
+// and whether it came from a zone specific color.
+// expects writeMutex to be held
+func topOverlayZoneColor(zone string) (string, bool) {
+	for _, o := range overlays {
+		if o.color != "" {
+			return o.color, false
+		}
+		if color := o.zoneColors[zone]; color != "" {
+			return color, true
+		}
+	}
+	return "", false
+}
+
+// hasZoneOverlays determines if any Overlay is providing a zone color.
+// expects writeMutex to be held
+func hasZoneOverlays() bool {
+	for _, o := range overlays {
+		if len(o.zoneColors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeZoneOverlays writes any zone colors provided by overlays over the top of
+// what was last written to the whole keyboard.
+// expects writeMutex to be held
+func writeZoneOverlays() error {
+	if !hasZoneOverlays() {
+		return nil
+	}
+
+	for _, zone := range GetZones() {
+		color, isZone := topOverlayZoneColor(zone)
+		if !isZone {
+			continue
+		}
+
+		err := writeZoneColor(zone, color)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expects writeMutex to be held
+func topOverlayBrightness() string {
+	for _, o := range overlays {
+		if o.brightness != "" {
+			return o.brightness
+		}
+	}
+	return ""
+}
+
+// expects writeMutex to be held
+func captureBaseColor() {
+	if topOverlayColor() != "" {
+		return // hardware is showing an overlay, not the base
+	}
+
+	colors, err := GetCurrentColors()
+	if err != nil {
+		return
+	}
+
+	for _, c := range colors {
+		baseColor = c
+		break // all will be set to the same value
+	}
+}
+
+// expects writeMutex to be held
+func captureBaseBrightness() {
+	if topOverlayBrightness() != "" {
+		return // hardware is showing an overlay, not the base
+	}
+
+	brightness, err := GetCurrentBrightness()
+	if err == nil {
+		baseBrightness = brightness
+	}
+}
@@ -0,0 +1,199 @@
+// Package locks shows the state of the Caps, Num, and Scroll Lock keys on the
+// keyboard backlight, for keyboards without their own indicator LEDs. The state
+// is read from the kernel's LED class devices (e.g.
+// /sys/class/leds/input3::capslock) and from LED events reported by the input
+// devices, so it is correct no matter which program toggled the lock.
+package locks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/input"
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/rs/zerolog"
+)
+
+// Indicator tints the keyboard (or a single zone) while a lock is on. When more
+// than one lock is on, the color of the first in Order is shown.
+type Indicator struct {
+	Colors map[string]string // by lock name (an empty color ignores the lock)
+	Zone   string            // when empty, the entire keyboard is tinted
+
+	log     *zerolog.Logger
+	overlay *keyboard.Overlay
+	events  map[string]bool // lock state reported by input devices
+	shown   string
+}
+
+// Lock names.
+const (
+	CapsLock   = "caps"
+	NumLock    = "num"
+	ScrollLock = "scroll"
+)
+
+// Order is the precedence of the locks when more than one is on.
+var Order = []string{CapsLock, NumLock, ScrollLock}
+
+// OverlayPriority is the keyboard overlay priority used for lock colors. It is
+// above log alerts but below notifications.
+const OverlayPriority = 75
+
+// PollInterval is how often the LED class devices are checked for changes.
+const PollInterval = 250 * time.Millisecond
+
+// LEDsDir is where the kernel's LED class devices are found.
+var LEDsDir = "/sys/class/leds"
+
+// New returns an Indicator showing the provided colors.
+func New(colors map[string]string, zone string) (*Indicator, error) {
+	ind := &Indicator{Colors: map[string]string{}, Zone: zone, events: map[string]bool{}}
+
+	for lock, color := range colors {
+		if _, ok := ledCodes[lock]; !ok {
+			return nil, fmt.Errorf("unknown lock: %s (expected one of %s)", lock, strings.Join(Order, ", "))
+		}
+
+		if color == "" {
+			continue
+		}
+
+		rgb, err := keyboard.ParseColor(color)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %s lock color: %w", lock, err)
+		}
+
+		ind.Colors[lock] = rgb.GetColorInHex()
+	}
+
+	if zone != "" {
+		found := false
+		for _, z := range keyboard.GetZones() {
+			found = found || z == zone
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown keyboard zone: %s (expected one of %s)", zone, strings.Join(keyboard.GetZones(), ", "))
+		}
+	}
+
+	return ind, nil
+}
+
+// Len returns the number of locks shown.
+func (ind *Indicator) Len() int {
+	return len(ind.Colors)
+}
+
+// Watch will show the state of the locks until the context is canceled. LED
+// events from the input devices chosen by the selector trigger an immediate
+// update; otherwise, the LED class devices are polled.
+func (ind *Indicator) Watch(ctx context.Context, log *zerolog.Logger, selects input.Selector) error {
+	watcher, err := input.Watch(ctx, log, selects)
+	if err != nil {
+		return err
+	}
+
+	ind.log = log
+	ind.overlay = keyboard.AddOverlay("locks", OverlayPriority)
+	log.Debug().Int("locks", ind.Len()).Str("zone", ind.Zone).Msg("watching lock states")
+
+	go func() {
+		defer util.LogRecover()
+		defer ind.overlay.Remove()
+
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+
+		ind.update()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-watcher.Events:
+				if ev.Type != input.EvLED {
+					continue
+				}
+
+				for lock, code := range ledCodes {
+					if code == ev.Code {
+						ind.events[lock] = ev.Value != 0
+					}
+				}
+			case <-ticker.C:
+			}
+
+			ind.update()
+		}
+	}()
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+var ledCodes = map[string]uint16{
+	CapsLock:   input.LedCapsLock,
+	NumLock:    input.LedNumLock,
+	ScrollLock: input.LedScrollLock,
+}
+
+// update shows the color of the first lock that is on (if any)
+func (ind *Indicator) update() {
+	color := ""
+	for _, lock := range Order {
+		if ind.Colors[lock] != "" && ind.isOn(lock) {
+			color = ind.Colors[lock]
+			break
+		}
+	}
+
+	if color == ind.shown {
+		return
+	}
+
+	var err error
+	switch {
+	case color == "" && ind.Zone == "":
+		err = ind.overlay.ClearColor()
+	case color == "":
+		err = ind.overlay.ClearZoneColor(ind.Zone)
+	case ind.Zone == "":
+		err = ind.overlay.SetColor(color)
+	default:
+		err = ind.overlay.SetZoneColor(ind.Zone, color)
+	}
+
+	if err != nil {
+		ind.log.Err(err).Str("color", color).Msg("can't show lock state")
+		return
+	}
+
+	ind.log.Debug().Str("color", color).Msg("lock state changed")
+	ind.shown = color
+}
+
+// isOn determines if any keyboard has the lock on, preferring the LED class
+// devices and falling back to the state reported by input device events
+func (ind *Indicator) isOn(lock string) bool {
+	paths, _ := filepath.Glob(filepath.Join(LEDsDir, "input*::"+lock+"lock", "brightness"))
+	if len(paths) == 0 {
+		return ind.events[lock]
+	}
+
+	for _, path := range paths {
+		val, err := os.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(val)) != "0" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,245 @@
+// Package metrics provides readers for system measurements (CPU, memory, load,
+// temperature, battery, etc.) that can be used to drive patterns.
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+)
+
+// CommandTimeout is the longest a command is allowed to run before it (and
+// anything it started) is killed.
+const CommandTimeout = 10 * time.Second
+
+// CPUStats is a snapshot of the cumulative CPU times reported by the kernel.
+type CPUStats struct {
+	Active int
+	Total  int
+}
+
+// GetCPUStats reads the aggregate CPU times from /proc/stat.
+func GetCPUStats() (*CPUStats, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, fmt.Errorf("can't open system stats: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("can't read system stats: %w", err)
+	}
+
+	parts := strings.Split(line, " ")
+
+	// name, _ := strconv.Atoi(parts[0])
+	user, _ := strconv.Atoi(parts[1])
+	nice, _ := strconv.Atoi(parts[2])
+	system, _ := strconv.Atoi(parts[3])
+	idle, _ := strconv.Atoi(parts[4])
+	iowait, _ := strconv.Atoi(parts[5])
+	// irq, _ := strconv.Atoi(parts[6])
+	softirq, _ := strconv.Atoi(parts[7])
+	steal, _ := strconv.Atoi(parts[8])
+	// guest, _ := strconv.Atoi(parts[9])
+
+	stats := &CPUStats{Active: user + system + nice + softirq + steal}
+	stats.Total = stats.Active + idle + iowait
+
+	return stats, nil
+}
+
+// UtilizationSince returns the fraction (0.0 to 1.0) of time the CPU was active
+// between the previous snapshot and this one.
+func (s *CPUStats) UtilizationSince(previous *CPUStats) float64 {
+	total := s.Total - previous.Total
+	if total <= 0 {
+		return 0
+	}
+	return float64(s.Active-previous.Active) / float64(total)
+}
+
+// MemoryUsage returns the percentage (0 to 100) of memory currently in use.
+func MemoryUsage() (float64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("can't open memory info: %w", err)
+	}
+	defer f.Close()
+
+	var total, available float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total, _ = strconv.ParseFloat(fields[1], 64)
+		case "MemAvailable:":
+			available, _ = strconv.ParseFloat(fields[1], 64)
+		}
+	}
+
+	if total == 0 {
+		return 0, fmt.Errorf("can't find total memory")
+	}
+
+	return 100 * (total - available) / total, nil
+}
+
+// LoadAverage returns the 1, 5, and 15 minute system load averages.
+func LoadAverage() ([3]float64, error) {
+	var loads [3]float64
+
+	content, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return loads, fmt.Errorf("can't read load average: %w", err)
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) < 3 {
+		return loads, fmt.Errorf("can't parse load average: %s", content)
+	}
+
+	for i := range loads {
+		loads[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return loads, fmt.Errorf("can't parse load average: %w", err)
+		}
+	}
+
+	return loads, nil
+}
+
+// Temperature returns the hottest thermal zone reading in degrees Celsius.
+func Temperature() (float64, error) {
+	paths, _ := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("can't find any thermal zones")
+	}
+
+	hottest := 0.0
+	for _, p := range paths {
+		milli, err := ReadFileValue(p)
+		if err != nil {
+			continue
+		}
+		if temp := milli / 1000; temp > hottest {
+			hottest = temp
+		}
+	}
+
+	return hottest, nil
+}
+
+// Battery returns the capacity percentage (0 to 100) of the first battery found.
+func Battery() (float64, error) {
+	paths, _ := filepath.Glob("/sys/class/power_supply/BAT*/capacity")
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("can't find a battery")
+	}
+
+	return ReadFileValue(paths[0])
+}
+
+// NumCPU returns the number of logical CPUs available.
+func NumCPU() float64 {
+	return float64(runtime.NumCPU())
+}
+
+// ReadFileValue reads the first number found in the contents of a file (i.e. the
+// first whitespace separated field that is a number).
+func ReadFileValue(pathname string) (float64, error) {
+	content, err := os.ReadFile(pathname)
+	if err != nil {
+		return 0, fmt.Errorf("can't read %s: %w", pathname, err)
+	}
+
+	return parseValue(string(content))
+}
+
+// CommandValue runs a shell command and reads the first number found in its
+// output (i.e. the first whitespace separated field that is a number). When
+// running as root, the command is run as the invoking user instead. The command
+// is killed if it takes longer than CommandTimeout or the context is canceled.
+func CommandValue(ctx context.Context, command string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if os.Getuid() == 0 {
+		// never run user provided commands as root
+		u, err := util.InvokingUser()
+		if err != nil {
+			return 0, err
+		}
+
+		err = util.RunAs(cmd, u)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+
+	err := cmd.Start()
+	if err != nil {
+		return 0, fmt.Errorf("can't run %s: %w", command, err)
+	}
+
+	exited := make(chan bool)
+	go func() {
+		defer util.LogRecover()
+		select {
+		case <-exited:
+		case <-ctx.Done():
+			// the whole process group, so nothing left behind keeps the output open
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}()
+
+	err = cmd.Wait()
+	close(exited)
+
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("can't run %s: %w", command, ctx.Err())
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("can't run %s: %w", command, err)
+	}
+
+	return parseValue(out.String())
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+func parseValue(content string) (float64, error) {
+	for _, field := range strings.Fields(content) {
+		val, err := strconv.ParseFloat(field, 64)
+		if err == nil {
+			return val, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no value found")
+}
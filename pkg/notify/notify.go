@@ -0,0 +1,219 @@
+// Package notify provides alerts that temporarily take over the keyboard
+// backlight and then restore whatever was showing underneath them (e.g. a
+// running pattern).
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/rs/zerolog"
+)
+
+// Notification describes an alert to show on the keyboard.
+type Notification struct {
+	Color    string
+	Count    int
+	Style    string
+	Priority int
+	Delay    time.Duration
+
+	seq int
+}
+
+const (
+	// BlinkStyle toggles the keyboard on and off with the notification color.
+	BlinkStyle = "blink"
+
+	// PulseStyle fades the keyboard brightness up and down with the
+	// notification color.
+	PulseStyle = "pulse"
+)
+
+// OverlayPriority is the keyboard overlay priority used for notifications.
+const OverlayPriority = 100
+
+// Validate ensures the notification can be shown.
+func (n *Notification) Validate() error {
+	if n.Color != keyboard.RandomColor {
+		if _, err := keyboard.ParseColor(n.Color); err != nil {
+			return err
+		}
+	}
+
+	if n.Style != BlinkStyle && n.Style != PulseStyle {
+		return fmt.Errorf("unknown notification style: %s", n.Style)
+	}
+
+	if n.Count < 1 {
+		return fmt.Errorf("notification count must be at least 1: %d", n.Count)
+	}
+
+	if n.Delay <= 0 {
+		return fmt.Errorf("notification delay must be positive: %s", n.Delay)
+	}
+
+	return nil
+}
+
+// String returns a readable representation of the notification.
+func (n *Notification) String() string {
+	return fmt.Sprintf("%s %s x%d", n.Style, n.Color, n.Count)
+}
+
+// Play shows the notification immediately, blocking until it has finished or
+// ctx is canceled.
+func Play(ctx context.Context, n *Notification) error {
+	err := n.Validate()
+	if err != nil {
+		return err
+	}
+
+	overlay := keyboard.AddOverlay("notify", OverlayPriority)
+	defer overlay.Remove()
+
+	err = overlay.SetColor(n.Color)
+	if err != nil {
+		return err
+	}
+
+	switch n.Style {
+	case BlinkStyle:
+		return blink(ctx, overlay, n)
+	case PulseStyle:
+		return pulse(ctx, overlay, n)
+	}
+
+	return nil
+}
+
+// Enqueue adds the notification to the queue to be shown after any others of the
+// same or higher priority. The queue is processed in the background until ctx is
+// canceled.
+func Enqueue(ctx context.Context, log *zerolog.Logger, n *Notification) error {
+	err := n.Validate()
+	if err != nil {
+		return err
+	}
+
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+
+	queueSeq++
+	n.seq = queueSeq
+	queue = append(queue, n)
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].Priority != queue[j].Priority {
+			return queue[i].Priority > queue[j].Priority
+		}
+		return queue[i].seq < queue[j].seq
+	})
+
+	log.Debug().Str("notification", n.String()).Int("queued", len(queue)).Msg("enqueued")
+
+	if !processing {
+		processing = true
+		go process(ctx, log)
+	}
+
+	return nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+var queueMutex sync.Mutex
+var queue []*Notification
+var queueSeq int
+var processing bool
+
+func process(ctx context.Context, log *zerolog.Logger) {
+	defer util.LogRecover()
+
+	for {
+		queueMutex.Lock()
+		if len(queue) == 0 || ctx.Err() != nil {
+			queue = nil
+			processing = false
+			queueMutex.Unlock()
+			return
+		}
+		n := queue[0]
+		queue = queue[1:]
+		queueMutex.Unlock()
+
+		log.Info().Str("notification", n.String()).Msg("showing")
+		err := Play(ctx, n)
+		if err != nil {
+			log.Err(err).Str("notification", n.String()).Msg("failed")
+		}
+	}
+}
+
+func blink(ctx context.Context, overlay *keyboard.Overlay, n *Notification) error {
+	for i := 0; i < n.Count; i++ {
+		err := overlay.SetBrightness("255")
+		if err != nil {
+			return err
+		}
+
+		if sleep(ctx, n.Delay) {
+			return nil
+		}
+
+		err = overlay.SetBrightness("0")
+		if err != nil {
+			return err
+		}
+
+		if sleep(ctx, n.Delay) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func pulse(ctx context.Context, overlay *keyboard.Overlay, n *Notification) error {
+	// each pulse fades up and back down over twice the delay
+	const steps = 32
+	stepDelay := n.Delay / steps
+
+	for i := 0; i < n.Count; i++ {
+		for step := 0; step <= 2*steps; step++ {
+			level := step
+			if level > steps {
+				level = 2*steps - level
+			}
+
+			err := overlay.SetBrightness(strconv.Itoa(255 * level / steps))
+			if err != nil {
+				return err
+			}
+
+			if sleep(ctx, stepDelay) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func sleep(ctx context.Context, delay time.Duration) bool {
+	wake := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		wake.Stop()
+		return true
+	case <-wake.C:
+		return false
+	}
+}
@@ -1,20 +1,17 @@
 package patterns
 
 import (
-	"bufio"
-	"fmt"
 	"math"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/metrics"
 )
 
 // CPUPattern is used when changing colors from "cold" (blue) to "hot" (red)
 // according to the CPU utilization. The "delay" configuration value expresses
-// the amount of time to wait between samples.
+// the amount of time to wait between samples while the "gradient" value
+// expresses the colors to use.
 type CPUPattern struct {
 	BasePattern
 
@@ -29,8 +26,13 @@ func init() {
 }
 
 func (p *CPUPattern) run() error {
+	colors, err := p.getGradient()
+	if err != nil {
+		return err
+	}
+
 	for {
-		previous, err := getCPUStats()
+		previous, err := metrics.GetCPUStats()
 		if err != nil {
 			return err
 		}
@@ -39,14 +41,14 @@ func (p *CPUPattern) run() error {
 			return nil
 		}
 
-		current, err := getCPUStats()
+		current, err := metrics.GetCPUStats()
 		if err != nil {
 			return err
 		}
 
-		cpuPercentage := float64(current.active-previous.active) / float64(current.total-previous.total)
-		i := int(math.Round(float64(len(coldHotColors)-1) * cpuPercentage))
-		color := coldHotColors[i]
+		cpuPercentage := current.UtilizationSince(previous)
+		i := int(math.Round(float64(len(colors)-1) * cpuPercentage))
+		color := colors[i]
 
 		if color == p.lastColor {
 			continue
@@ -60,40 +62,3 @@ func (p *CPUPattern) run() error {
 		p.lastColor = color
 	}
 }
-
-type cpuStats struct {
-	active int
-	total  int
-}
-
-func getCPUStats() (*cpuStats, error) {
-	f, err := os.Open("/proc/stat")
-	if err != nil {
-		return nil, fmt.Errorf("can't open system stats: %w", err)
-	}
-	defer f.Close()
-
-	reader := bufio.NewReader(f)
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("can't read system stats: %w", err)
-	}
-
-	parts := strings.Split(line, " ")
-
-	// name, _ := strconv.Atoi(parts[0])
-	user, _ := strconv.Atoi(parts[1])
-	nice, _ := strconv.Atoi(parts[2])
-	system, _ := strconv.Atoi(parts[3])
-	idle, _ := strconv.Atoi(parts[4])
-	iowait, _ := strconv.Atoi(parts[5])
-	// irq, _ := strconv.Atoi(parts[6])
-	softirq, _ := strconv.Atoi(parts[7])
-	steal, _ := strconv.Atoi(parts[8])
-	// guest, _ := strconv.Atoi(parts[9])
-
-	stats := &cpuStats{active: user + system + nice + softirq + steal}
-	stats.total = stats.active + idle + iowait
-
-	return stats, nil
-}
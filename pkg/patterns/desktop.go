@@ -1,45 +1,113 @@
 package patterns
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"net/url"
 	"os"
-	"os/exec"
-	"regexp"
+	"os/user"
+	"path/filepath"
 	"strings"
-	"syscall"
-	"unicode"
+	"time"
 
+	"github.com/BitPonyLLC/huekeys/internal/desktop"
 	"github.com/BitPonyLLC/huekeys/internal/image_matcher"
 	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
 	"github.com/BitPonyLLC/huekeys/pkg/util"
-
-	"github.com/rs/zerolog"
 )
 
 // DesktopPattern is used when setting colors according to the dominant color of
-// the active Gnome Desktop background picture.
+// the active desktop background picture. The "source" configuration value
+// chooses how the picture is found (e.g. gnome, kde, xfce, sway) and, when
+// empty, it is chosen according to the current desktop. The "mode" chooses
+// whether only the dominant color is shown or the top colors of the picture's
+// palette are cycled through or spread across the keyboard's zones.
 type DesktopPattern struct {
 	BasePattern
 
-	env               *preservedEnv
-	backgroundProcess *os.Process
+	env    *preservedEnv
+	colors []keyboard.RGBColor
+	shown  int
 }
 
+// Modes of showing the colors of the desktop picture.
+const (
+	// DominantMode shows the dominant color across the whole keyboard.
+	DominantMode = "dominant"
+	// CycleMode slowly crossfades through the top colors of the picture.
+	CycleMode = "cycle"
+	// ZonesMode spreads the top colors of the picture across the keyboard's
+	// zones (showing only the dominant color on single zone keyboards).
+	ZonesMode = "zones"
+)
+
+// DesktopModes are the names of all the modes of the desktop pattern.
+var DesktopModes = []string{DominantMode, CycleMode, ZonesMode}
+
+// ColorsLabel is used to get the number of top colors of the desktop picture
+// cycled through or spread across zones.
+const ColorsLabel = "colors"
+
+// CyclePeriodLabel is used to get how long each color is shown when cycling.
+const CyclePeriodLabel = "cycle-period"
+
+// CrossfadeLabel is used to get how long it takes to fade from one color to the
+// next when cycling.
+const CrossfadeLabel = "crossfade"
+
+// DefaultDesktopColors is the default number of top colors used by the cycle
+// and zones modes.
+const DefaultDesktopColors = 3
+
+// DefaultCyclePeriod is the default amount of time each color is shown when
+// cycling.
+const DefaultCyclePeriod = 30 * time.Second
+
+// DefaultCrossfade is the default amount of time taken to fade between colors
+// when cycling.
+const DefaultCrossfade = 5 * time.Second
+
+// SourceLabel is used to get the desktop background (or theme) source from
+// configuration.
+const SourceLabel = "source"
+
+// StrategyLabel is used to get how the dominant color of the picture is chosen.
+const StrategyLabel = "strategy"
+
+// ClustersLabel is used to get the number of colors extracted from the picture.
+const ClustersLabel = "clusters"
+
+// MinSaturationLabel is used to get the lowest saturation a color may have when
+// chosen by the saturated strategy.
+const MinSaturationLabel = "min-saturation"
+
+// ExcludeExtremesLabel is used to get whether near-black and near-white colors
+// are avoided.
+const ExcludeExtremesLabel = "exclude-extremes"
+
+// CacheLabel is used to get the directory where the colors extracted from
+// pictures are kept (none are kept when empty).
+const CacheLabel = "cache"
+
+// RootCacheDir is where the colors extracted from pictures are always kept when
+// running as root, regardless of the configured directory (unless turned off).
+const RootCacheDir = "/var/cache/huekeys"
+
+// CenterWeightedLabel is used to get whether colors toward the center of the
+// picture count more.
+const CenterWeightedLabel = "center-weighted"
+
 var _ Pattern = (*DesktopPattern)(nil)  // ensures we conform to the Pattern interface
 var _ runnable = (*DesktopPattern)(nil) // ensures we conform to the runnable interface
 
 // DesktopPatternEnv returns an encoded environment variable needed to be passed
 // along when run as root to preserve access to to the parent user's desktop
-// configuration (gsettings).
+// configuration.
 func DesktopPatternEnv() (string, error) {
 	pe := preservedEnv{
-		User:       os.Getenv(userKey),
-		RuntimeDir: os.Getenv(runtimeDirKey),
+		User:           os.Getenv(userKey),
+		RuntimeDir:     os.Getenv(runtimeDirKey),
+		CurrentDesktop: os.Getenv(currentDesktopKey),
 	}
 
 	var key string
@@ -67,8 +135,8 @@ func DesktopPatternEnv() (string, error) {
 }
 
 // SetEnv is invoked when the DesktopPattern needs additional environment values
-// to pass along to the gsettings process (e.g. to ensure it monitors the right
-// user desktop).
+// to find the user's desktop (e.g. to ensure it monitors the right user desktop
+// when run as root).
 func (p *DesktopPattern) SetEnv(env string) error {
 	p.env = &preservedEnv{}
 
@@ -94,162 +162,300 @@ func (p *DesktopPattern) SetEnv(env string) error {
 	return nil
 }
 
+// MatchOptions returns the configured options used to choose the dominant color
+// of the desktop picture.
+func (p *DesktopPattern) MatchOptions() *image_matcher.Options {
+	cacheDir := config.GetString(p.Name + "." + CacheLabel)
+	if cacheDir != "" && os.Getuid() == 0 {
+		// never let root write its cache anywhere a user could choose
+		cacheDir = RootCacheDir
+	}
+
+	return &image_matcher.Options{
+		Strategy:        config.GetString(p.Name + "." + StrategyLabel),
+		Clusters:        config.GetInt(p.Name + "." + ClustersLabel),
+		MinSaturation:   config.GetFloat64(p.Name + "." + MinSaturationLabel),
+		ExcludeExtremes: config.GetBool(p.Name + "." + ExcludeExtremesLabel),
+		CenterWeighted:  config.GetBool(p.Name + "." + CenterWeightedLabel),
+		CacheDir:        cacheDir,
+	}
+}
+
 //--------------------------------------------------------------------------------
 // private
 
 type preservedEnv struct {
-	User       string
-	RuntimeDir string
+	User           string
+	RuntimeDir     string
+	CurrentDesktop string
 }
 
 const desktopPatternKey = "DESKTOP_PATTERN"
 const userKey = "USER"
 const runtimeDirKey = "XDG_RUNTIME_DIR"
+const currentDesktopKey = "XDG_CURRENT_DESKTOP"
 
-var pictureURIMonitorRE = regexp.MustCompile(`^\s*picture-uri(?:-dark)?:\s*'([^']+)'\s*$`)
+// the time between colors written while crossfading
+const crossfadeStep = 100 * time.Millisecond
 
 func init() {
 	register("desktop", &DesktopPattern{}, 0)
 }
 
 func (p *DesktopPattern) run() error {
-	if p.env == nil {
-		p.SetEnv(os.Getenv(desktopPatternKey))
-	}
-
-	colorScheme, err := p.getDesktopSetting("interface", "color-scheme")
+	env, err := p.sessionEnv()
 	if err != nil {
 		return err
 	}
 
-	pictureKey := "picture-uri"
-	if colorScheme == "prefer-dark" {
-		pictureKey += "-dark"
+	if err = p.checkMode(); err != nil {
+		return err
 	}
 
-	pictureURIStr, err := p.getDesktopSetting("background", pictureKey)
+	source, err := desktop.New(config.GetString(p.Name+"."+SourceLabel), env)
 	if err != nil {
 		return err
 	}
 
-	pictureURL, err := url.Parse(pictureURIStr)
+	path, err := source.Wallpaper()
 	if err != nil {
-		return fmt.Errorf("can't parse picture URI (%s): %w", pictureURIStr, err)
+		return err
 	}
 
-	err = p.setColorFrom(pictureURL.Path)
+	err = p.setColorFrom(path)
 	if err != nil {
 		return err
 	}
 
-	cmd := p.newDesktopSettingCmd("monitor", "background", pictureKey)
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	stdout, err := cmd.StdoutPipe()
+	changes := make(chan string)
+	err = desktop.Watch(p.ctx, p.log, source, func(path string) {
+		select {
+		case changes <- path:
+		case <-p.ctx.Done():
+		}
+	})
 	if err != nil {
-		return fmt.Errorf("can't get stdout of desktop background monitor: %w", err)
+		return err
 	}
 
-	err = cmd.Start()
-	if err != nil {
-		return fmt.Errorf("can't start desktop background monitor: %w", err)
-	}
+	for {
+		// slideshows change the picture shown without changing the configuration
+		var slideChange <-chan time.Time
+		var slideTimer *time.Timer
+		if next := p.nextSlideChange(path); next > 0 {
+			slideTimer = time.NewTimer(next)
+			slideChange = slideTimer.C
+		}
 
-	p.backgroundProcess = cmd.Process
-	p.log.Debug().Int("pid", p.backgroundProcess.Pid).Str("cmd", cmd.String()).Msg("started")
+		var cycleChange <-chan time.Time
+		var cycleTimer *time.Timer
+		if period := config.GetDuration(p.Name + "." + CyclePeriodLabel); period > 0 && p.mode() == CycleMode && len(p.colors) > 1 {
+			cycleTimer = time.NewTimer(period)
+			cycleChange = cycleTimer.C
+		}
 
-	go func() {
-		defer util.LogRecover()
-		proc := p.backgroundProcess
-		state, err := proc.Wait()
-		var ev *zerolog.Event
-		if p.stopRequested {
-			ev = p.log.Debug()
-		} else {
-			ev = p.log.Error()
+		stopped := false
+		cycle := false
+		select {
+		case <-p.ctx.Done():
+			stopped = true
+		case path = <-changes:
+		case <-slideChange:
+		case <-cycleChange:
+			cycle = true
 		}
-		ev.Err(err).Int("pid", proc.Pid).Str("state", state.String()).
-			Msg("desktop background monitor has stopped")
-	}()
-
-	go func() {
-		defer util.LogRecover()
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			m := pictureURIMonitorRE.FindStringSubmatch(line)
-			if m == nil || len(m) < 2 || m[1] == "" {
-				p.log.Warn().Str("line", line).Msg("ignoring unknown content from desktop background monitor")
-				continue
-			}
-			p.setColorFrom(m[1])
+
+		if slideTimer != nil {
+			slideTimer.Stop()
+		}
+
+		if cycleTimer != nil {
+			cycleTimer.Stop()
 		}
-	}()
 
-	<-p.ctx.Done()
-	p.stopDesktopBackgroundMonitor()
+		if stopped {
+			p.stopRequested = true
+			return nil
+		}
 
-	return nil
+		if cycle {
+			stopped, err = p.crossfade()
+			if err != nil || stopped {
+				return err
+			}
+
+			continue
+		}
+
+		err = p.setColorFrom(path)
+		if err != nil {
+			p.log.Err(err).Str("path", path).Msg("can't set color")
+		}
+	}
 }
 
-func (p *DesktopPattern) getDesktopSetting(group, key string) (string, error) {
-	val, err := p.newDesktopSettingCmd("get", group, key).Output()
+// nextSlideChange returns how long until a slideshow shows a different picture
+// (or zero if not a slideshow)
+func (p *DesktopPattern) nextSlideChange(path string) time.Duration {
+	if !strings.EqualFold(filepath.Ext(path), ".xml") {
+		return 0
+	}
+
+	_, next, err := image_matcher.ResolveSlideshow(path, time.Now())
 	if err != nil {
-		p.log.Err(err).Str("group", group).Str("key", key).Msg("can't get setting value")
-		return "", err
+		p.log.Warn().Err(err).Msg("can't follow slideshow")
+		return 0
+	}
+
+	return next
+}
+
+// sessionEnv describes the desktop of the preserved user (see SetEnv), which is
+// also used by the theme pattern.
+func (p *DesktopPattern) sessionEnv() (*desktop.Env, error) {
+	if p.env == nil {
+		p.SetEnv(os.Getenv(desktopPatternKey))
 	}
 
-	val = bytes.TrimFunc(val, func(r rune) bool { return unicode.IsSpace(r) || r == '\'' })
-	return string(val), nil
+	return p.desktopEnv()
 }
 
-func (p *DesktopPattern) newDesktopSettingCmd(action, group, key string) *exec.Cmd {
-	fullGroup := "org.gnome.desktop." + group
-	cmd := "gsettings"
-	args := []string{action, fullGroup, key}
+// desktopEnv describes the desktop of the preserved user (or of the one that
+// started this process)
+func (p *DesktopPattern) desktopEnv() (*desktop.Env, error) {
+	env := &desktop.Env{
+		User:           p.env.User,
+		RuntimeDir:     p.env.RuntimeDir,
+		CurrentDesktop: p.env.CurrentDesktop,
+	}
 
-	if p.env.User != "" {
-		shCmd := p.env.String() + cmd + " " + strings.Join(args, " ")
-		cmd = "sudo"
-		args = []string{"-u", p.env.User, "sh", "-c", shCmd}
+	if env.CurrentDesktop == "" {
+		env.CurrentDesktop = os.Getenv(currentDesktopKey)
 	}
 
-	return exec.Command(cmd, args...)
+	var u *user.User
+	var err error
+	if env.User != "" {
+		u, err = user.Lookup(env.User)
+	} else {
+		u, err = util.InvokingUser()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't find desktop user: %w", err)
+	}
+
+	env.Home = u.HomeDir
+	return env, nil
 }
 
-func (p *DesktopPattern) setColorFrom(u string) error {
-	pictureURL, err := url.Parse(u)
+func (p *DesktopPattern) setColorFrom(path string) error {
+	if err := checkUserCanReadPath(path); err != nil {
+		return err
+	}
+
+	// a slideshow may name any picture: the user must be able to read it too
+	picture, err := image_matcher.Resolve(path)
 	if err != nil {
-		return fmt.Errorf("can't parse picture URI (%s): %w", pictureURL, err)
+		return fmt.Errorf("can't determine dominant color: %w", err)
 	}
 
-	color, err := image_matcher.GetDominantColorOf(pictureURL.Path)
+	if picture != path {
+		if err = checkUserCanReadPath(picture); err != nil {
+			return err
+		}
+	}
+
+	palette, err := image_matcher.GetPaletteOf(picture, p.MatchOptions())
 	if err != nil {
 		return fmt.Errorf("can't determine dominant color: %w", err)
 	}
 
-	p.log.Info().Str("color", color).Str("path", pictureURL.Path).Msg("setting")
+	p.colors = topColors(palette, p.numColors())
+	p.shown = 0
+
+	p.log.Info().Str("color", p.colors[0].GetColorInHex()).Int("colors", len(p.colors)).Str("path", path).Msg("setting")
 
-	return keyboard.ColorFileHandler(color)
+	if p.mode() == ZonesMode {
+		zones := keyboard.GetZones()
+		if len(zones) > 1 {
+			for i, zone := range zones {
+				err = p.writeZoneColor(zone, p.colors[i%len(p.colors)].GetColorInHex())
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	return p.writeColor(p.colors[0].GetColorInHex())
 }
 
-func (p *DesktopPattern) stopDesktopBackgroundMonitor() {
-	if p.backgroundProcess != nil {
-		proc := p.backgroundProcess
-		p.log.Debug().Int("pid", proc.Pid).Msg("stopping desktop background monitor")
-		p.stopRequested = true
-		err := syscall.Kill(-proc.Pid, syscall.SIGTERM)
+// crossfade gradually changes the keyboard from the color shown to the next
+// one of the picture, returning true if stopped along the way.
+func (p *DesktopPattern) crossfade() (bool, error) {
+	from := p.colors[p.shown]
+	p.shown = (p.shown + 1) % len(p.colors)
+	to := p.colors[p.shown]
+
+	steps := int(config.GetDuration(p.Name+"."+CrossfadeLabel) / crossfadeStep)
+	for i := 1; i < steps; i++ {
+		err := p.writeColor(from.BlendPerceptual(to, float64(i)/float64(steps)).GetColorInHex())
 		if err != nil {
-			p.log.Err(err).Int("pid", proc.Pid).Msg("can't kill desktop background monitor")
+			return false, err
+		}
+
+		if p.cancelableSleepFor(crossfadeStep) {
+			return true, nil
+		}
+	}
+
+	return false, p.writeColor(to.GetColorInHex())
+}
+
+func (p *DesktopPattern) mode() string {
+	mode := config.GetString(p.Name + "." + ModeLabel)
+	if mode == "" {
+		return DominantMode
+	}
+	return mode
+}
+
+func (p *DesktopPattern) checkMode() error {
+	mode := p.mode()
+	for _, known := range DesktopModes {
+		if mode == known {
+			return nil
 		}
 	}
+
+	return fmt.Errorf("unknown desktop mode %q: expected one of %s", mode, strings.Join(DesktopModes, ", "))
 }
 
-func (e *preservedEnv) String() string {
-	str := ""
+func (p *DesktopPattern) numColors() int {
+	if p.mode() == DominantMode {
+		return 1
+	}
+
+	n := config.GetInt(p.Name + "." + ColorsLabel)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// topColors returns up to n colors of a palette in order, leaving out those
+// excluded unless there's nothing else.
+func topColors(palette []image_matcher.Swatch, n int) []keyboard.RGBColor {
+	colors := []keyboard.RGBColor{}
+	for _, s := range palette {
+		if len(colors) == n || (s.Excluded && len(colors) > 0) {
+			break
+		}
 
-	if e.RuntimeDir != "" {
-		str += runtimeDirKey + "=" + e.RuntimeDir + " "
+		r, g, b := s.RGB()
+		colors = append(colors, keyboard.RGBColor{Red: int(r), Green: int(g), Blue: int(b)})
 	}
 
-	return str
+	return colors
 }
@@ -0,0 +1,220 @@
+package patterns
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+)
+
+// ExecPattern is used when changing colors according to the output of an
+// external command. Each line printed by the command may contain any number of
+// colors, brightness values, or zone=color assignments (see
+// keyboard.GetZones). The command is restarted if it exits, waiting longer
+// after each failure. The "delay" configuration value expresses the initial
+// amount of time to wait before restarting the command.
+type ExecPattern struct {
+	BasePattern
+}
+
+// CommandLabel is used to get the command to run from configuration.
+const CommandLabel = "command"
+
+// MaxExecBackoff is the longest amount of time to wait before restarting the
+// command. If the command runs for longer than this, the wait is reset back to
+// the initial delay.
+const MaxExecBackoff = time.Minute
+
+// ExecStopGrace is how long the command is given to exit once asked to stop
+// before it (and anything it started) is killed.
+const ExecStopGrace = 2 * time.Second
+
+var _ Pattern = (*ExecPattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*ExecPattern)(nil) // ensures we conform to the runnable interface
+
+// String is a customized version of the BasePattern String that also includes
+// the command.
+func (p *ExecPattern) String() string {
+	return fmt.Sprintf("%s %s=%q", p.BasePattern.String(), CommandLabel, config.GetString(p.Name+"."+CommandLabel))
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+func init() {
+	register("exec", &ExecPattern{}, 1*time.Second)
+}
+
+func (p *ExecPattern) run() error {
+	command := config.GetString(p.Name + "." + CommandLabel)
+	if command == "" {
+		return fmt.Errorf("no command to run: provide one with --%s", CommandLabel)
+	}
+
+	backoff := p.getDelay()
+
+	for {
+		startedAt := time.Now()
+		err := p.runCommand(command)
+		if p.ctx.Err() != nil {
+			p.stopRequested = true
+			return nil
+		}
+
+		if time.Since(startedAt) > MaxExecBackoff {
+			backoff = p.getDelay()
+		}
+
+		p.log.Warn().Err(err).Dur("backoff", backoff).Msg("command exited: restarting")
+
+		if p.cancelableSleepFor(backoff) {
+			return nil
+		}
+
+		backoff *= 2
+		if backoff > MaxExecBackoff {
+			backoff = MaxExecBackoff
+		}
+	}
+}
+
+func (p *ExecPattern) runCommand(command string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if os.Getuid() == 0 {
+		// never run user provided commands as root
+		u, err := util.InvokingUser()
+		if err != nil {
+			return err
+		}
+
+		err = util.RunAs(cmd, u)
+		if err != nil {
+			return err
+		}
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("can't get stdout of command: %w", err)
+	}
+
+	stderr := &util.CommandLogger{Log: func(msg string) { p.log.Warn().Str("stderr", msg).Msg("command") }}
+	defer stderr.Close()
+	cmd.Stderr = stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("can't start command: %w", err)
+	}
+
+	proc := cmd.Process
+	p.log.Debug().Int("pid", proc.Pid).Str("cmd", cmd.String()).Msg("started")
+
+	exited := make(chan bool)
+	defer close(exited)
+
+	go func() {
+		defer util.LogRecover()
+		select {
+		case <-exited:
+		case <-p.ctx.Done():
+			// signal the whole process group so anything the shell started is
+			// stopped too (and the output pipe is closed)
+			p.log.Debug().Int("pid", proc.Pid).Msg("stopping command")
+			err := syscall.Kill(-proc.Pid, syscall.SIGTERM)
+			if err != nil {
+				p.log.Err(err).Int("pid", proc.Pid).Msg("can't stop command")
+			}
+
+			grace := time.NewTimer(ExecStopGrace)
+			defer grace.Stop()
+
+			select {
+			case <-exited:
+			case <-grace.C:
+				p.log.Warn().Int("pid", proc.Pid).Msg("command ignored stop: killing")
+				err = syscall.Kill(-proc.Pid, syscall.SIGKILL)
+				if err != nil {
+					p.log.Err(err).Int("pid", proc.Pid).Msg("can't kill command")
+				}
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		err = p.apply(scanner.Text())
+		if err != nil {
+			p.log.Warn().Err(err).Str("line", scanner.Text()).Msg("ignoring")
+		}
+	}
+
+	return cmd.Wait()
+}
+
+func (p *ExecPattern) apply(line string) error {
+	for _, field := range strings.Fields(line) {
+		zone, color, isZone := strings.Cut(field, "=")
+		if isZone {
+			color, err := normalizeColor(color)
+			if err != nil {
+				return err
+			}
+
+			err = p.writeZoneColor(zone, color)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// only short numbers are brightness values: all-digit colors (e.g.
+		// 000080) are six characters long
+		val, err := strconv.Atoi(field)
+		if err == nil && len(field) <= 3 && 0 <= val && val < 256 {
+			err = p.writeBrightness(field)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		color, err = normalizeColor(field)
+		if err != nil {
+			return err
+		}
+
+		err = p.writeColor(color)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// normalizeColor ensures a color is known and converts it into the form written
+// to the keyboard (e.g. without a leading '#')
+func normalizeColor(color string) (string, error) {
+	if color == keyboard.RandomColor {
+		return color, nil
+	}
+
+	rgb, err := keyboard.ParseColor(color)
+	if err != nil {
+		return "", err
+	}
+
+	return rgb.GetColorInHex(), nil
+}
@@ -0,0 +1,135 @@
+package patterns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+)
+
+// GradientLabel is used to get the name (or list of color stops) of a pattern's
+// gradient from configuration.
+const GradientLabel = "gradient"
+
+// StepsLabel is used to get the number of colors a pattern's gradient is
+// interpolated into from configuration.
+const StepsLabel = "steps"
+
+// GradientsLabel is used to get custom named gradients from configuration.
+const GradientsLabel = "gradients"
+
+// DefaultGradient is the name of the gradient used when none is configured.
+const DefaultGradient = "classic"
+
+// DefaultGradientSteps is the number of colors a gradient is interpolated into
+// when not configured.
+const DefaultGradientSteps = 61
+
+// GradientNames returns the names of all built-in and configured gradients.
+func GradientNames() []string {
+	names := []string{}
+	for name := range builtinGradients {
+		names = append(names, name)
+	}
+	for name := range getCustomGradients() {
+		if _, exists := builtinGradients[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// color stops of the built-in gradients: viridis, cividis, and plasma are the
+// perceptually uniform (and color-blind friendly) maps from matplotlib while
+// blue-orange avoids the green/yellow hues that are hard to tell apart with the
+// most common forms of color blindness
+var builtinGradients = map[string][]string{
+	"classic":     coldHotColors,
+	"viridis":     {"440154", "482878", "3E4989", "31688E", "26828E", "1F9E89", "35B779", "6DCD59", "B4DE2C", "FDE725"},
+	"cividis":     {"00224E", "123570", "3B496C", "575D6D", "707173", "8A8779", "A69D75", "C4B56C", "E4CF5B", "FEE838"},
+	"plasma":      {"0D0887", "46039F", "7201A8", "9C179E", "BD3786", "D8576B", "ED7953", "FB9F3A", "FDCA26", "F0F921"},
+	"blue-orange": {"0000FF", "2166AC", "67A9CF", "D1E5F0", "FDDBC7", "EF8A62", "E66100", "FF4000"},
+}
+
+// getGradient returns the pattern's configured gradient interpolated into the
+// configured number of steps (always at least two)
+func (p *BasePattern) getGradient() ([]string, error) {
+	name := config.GetString(p.Name + "." + GradientLabel)
+	if name == "" {
+		name = DefaultGradient
+	}
+
+	steps := config.GetInt(p.Name + "." + StepsLabel)
+	if steps < 2 {
+		steps = DefaultGradientSteps
+	}
+
+	stops, ok := getCustomGradients()[name]
+	if !ok {
+		stops, ok = builtinGradients[name]
+	}
+	if !ok {
+		if !strings.Contains(name, ",") {
+			return nil, fmt.Errorf("unknown gradient: %s (expected one of %s or a comma separated list of colors)",
+				name, strings.Join(GradientNames(), ", "))
+		}
+		stops = strings.Split(name, ",")
+	}
+
+	return interpolateGradient(stops, steps)
+}
+
+func getCustomGradients() map[string][]string {
+	gradients := map[string][]string{}
+
+	custom, ok := config.Get(GradientsLabel).(map[string]interface{})
+	if !ok {
+		return gradients
+	}
+
+	for name, val := range custom {
+		list, ok := val.([]interface{})
+		if !ok {
+			continue
+		}
+		stops := make([]string, 0, len(list))
+		for _, stop := range list {
+			stops = append(stops, fmt.Sprint(stop))
+		}
+		gradients[name] = stops
+	}
+
+	return gradients
+}
+
+func interpolateGradient(stops []string, steps int) ([]string, error) {
+	if len(stops) < 2 {
+		return nil, fmt.Errorf("gradients require at least two colors: %v", stops)
+	}
+
+	colors := make([]keyboard.RGBColor, len(stops))
+	for i, stop := range stops {
+		var err error
+		colors[i], err = keyboard.ParseColor(strings.TrimSpace(stop))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gradient := make([]string, steps)
+	for i := range gradient {
+		pos := float64(i) / float64(steps-1) * float64(len(colors)-1)
+		j := int(pos)
+		if j >= len(colors)-1 {
+			j = len(colors) - 2
+		}
+		gradient[i] = colors[j].BlendPerceptual(colors[j+1], pos-float64(j)).GetColorInHex()
+	}
+
+	return gradient, nil
+}
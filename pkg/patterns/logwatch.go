@@ -0,0 +1,439 @@
+package patterns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// LogwatchPattern is used when changing colors according to lines appended to
+// log files. Each line is checked against a list of regular expressions and the
+// first one matching raises an alert that shows its color (optionally flashing)
+// over whatever is underneath until acknowledged. An optional base pattern runs
+// while no alert is active. Files are followed across rotation and truncation.
+type LogwatchPattern struct {
+	BasePattern
+
+	alertMutex  sync.Mutex
+	overlay     *keyboard.Overlay
+	alert       *logMatch
+	cancelFlash context.CancelFunc
+	flashDone   chan struct{} // closed when the flash goroutine has exited
+}
+
+// FilesLabel is used to get the list of files to watch from configuration.
+const FilesLabel = "files"
+
+// MatchLabel is used to get the list of matches from configuration.
+const MatchLabel = "match"
+
+// BaseLabel is used to get the pattern to run underneath alerts from
+// configuration.
+const BaseLabel = "base"
+
+// FlashLabel is used to get whether all alerts should flash from configuration.
+const FlashLabel = "flash"
+
+// LogwatchOverlayPriority is the keyboard overlay priority used for alerts. It is
+// lower than notifications so those are still shown while an alert is active.
+const LogwatchOverlayPriority = 50
+
+var _ Pattern = (*LogwatchPattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*LogwatchPattern)(nil) // ensures we conform to the runnable interface
+
+// String is a customized version of the BasePattern String that also includes
+// the files watched and any active alert.
+func (p *LogwatchPattern) String() string {
+	str := fmt.Sprintf("%s %s=%s", p.BasePattern.String(), FilesLabel,
+		strings.Join(config.GetStringSlice(p.Name+"."+FilesLabel), ","))
+
+	p.alertMutex.Lock()
+	defer p.alertMutex.Unlock()
+
+	if p.alert != nil {
+		str += fmt.Sprintf(" alert=%s", p.alert)
+	}
+
+	return str
+}
+
+// Ack will clear the active alert (if any), restoring whatever is underneath
+// it. Returns false if there was no alert to acknowledge.
+func (p *LogwatchPattern) Ack() (bool, error) {
+	p.alertMutex.Lock()
+	defer p.alertMutex.Unlock()
+
+	if p.alert == nil {
+		return false, nil
+	}
+
+	p.log.Info().Str("alert", p.alert.String()).Msg("acknowledged")
+	return true, p.clearAlert()
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+type logMatch struct {
+	re    *regexp.Regexp
+	color string
+	flash bool
+}
+
+type tailedFile struct {
+	path   string
+	file   *os.File
+	reader *bufio.Reader
+	offset int64
+	line   string // partial line waiting for its newline
+}
+
+func init() {
+	register("logwatch", &LogwatchPattern{}, 0)
+}
+
+func (m *logMatch) String() string {
+	str := m.re.String() + "=" + m.color
+	if m.flash {
+		str += " (flash)"
+	}
+	return str
+}
+
+func (p *LogwatchPattern) run() error {
+	paths := config.GetStringSlice(p.Name + "." + FilesLabel)
+	if len(paths) == 0 {
+		return fmt.Errorf("no files to watch: provide them with --%s", FilesLabel)
+	}
+
+	matches, err := p.loadMatches()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("can't create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	files := map[string]*tailedFile{}
+	for _, path := range paths {
+		path, err = expandHome(path)
+		if err != nil {
+			return err
+		}
+
+		tf := &tailedFile{path: path}
+		files[path] = tf
+		defer tf.close()
+
+		// start at the end: only new lines are interesting
+		err = p.open(tf, io.SeekEnd)
+		if err != nil {
+			p.log.Warn().Err(err).Msg("waiting for file to be created")
+		}
+
+		// watch the directory to follow rotation (i.e. removed and recreated)
+		err = watcher.Add(filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("can't watch %s: %w", path, err)
+		}
+	}
+
+	p.overlay = keyboard.AddOverlay(p.Name, LogwatchOverlayPriority)
+	defer func() {
+		p.alertMutex.Lock()
+		defer p.alertMutex.Unlock()
+		p.stopFlash()
+		p.alert = nil
+		p.overlay.Remove()
+	}()
+
+	p.startBase()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			p.stopRequested = true
+			return nil
+		case err := <-watcher.Errors:
+			p.log.Warn().Err(err).Msg("file watcher failed")
+		case ev := <-watcher.Events:
+			tf := files[filepath.Clean(ev.Name)]
+			if tf == nil {
+				continue
+			}
+
+			var err error
+			switch {
+			case ev.Op&fsnotify.Create != 0:
+				tf.close()
+				err = p.open(tf, io.SeekStart)
+			case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				tf.close()
+				continue
+			case ev.Op&fsnotify.Write != 0:
+				if tf.file == nil {
+					err = p.open(tf, io.SeekStart)
+				}
+			default:
+				continue
+			}
+
+			if err != nil {
+				p.log.Warn().Err(err).Msg("can't open file")
+				continue
+			}
+
+			for _, line := range tf.readLines() {
+				p.check(matches, line)
+			}
+		}
+	}
+}
+
+func (p *LogwatchPattern) loadMatches() ([]*logMatch, error) {
+	var entries []interface{}
+
+	switch val := config.Get(p.Name + "." + MatchLabel).(type) {
+	case nil:
+		return nil, fmt.Errorf("nothing to match: provide --%s or add [[%s.%s]] entries to the configuration", MatchLabel, p.Name, MatchLabel)
+	case []string:
+		for _, s := range val {
+			entries = append(entries, s)
+		}
+	case []interface{}:
+		entries = val
+	case []map[string]interface{}:
+		for _, m := range val {
+			entries = append(entries, m)
+		}
+	default:
+		return nil, fmt.Errorf("can't parse match configuration: %T", val)
+	}
+
+	flashAll := config.GetBool(p.Name + "." + FlashLabel)
+
+	matches := make([]*logMatch, 0, len(entries))
+	for i, entry := range entries {
+		var expr, color string
+		flash := flashAll
+
+		switch e := entry.(type) {
+		case string:
+			// the regex may contain '=' so only the last one separates the color
+			idx := strings.LastIndex(e, "=")
+			if idx < 0 {
+				return nil, fmt.Errorf("can't parse match %d: expected regex=color: %s", i+1, e)
+			}
+			expr, color = e[:idx], e[idx+1:]
+		case map[string]interface{}:
+			expr = configString(e, "regex")
+			color = configString(e, "color")
+			flash = flash || configString(e, "flash") == "true"
+		default:
+			return nil, fmt.Errorf("can't parse match %d: %T", i+1, entry)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse match %d regex: %w", i+1, err)
+		}
+
+		color, err = normalizeColor(color)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse match %d color: %w", i+1, err)
+		}
+
+		matches = append(matches, &logMatch{re: re, color: color, flash: flash})
+	}
+
+	return matches, nil
+}
+
+func (p *LogwatchPattern) startBase() {
+	name := config.GetString(p.Name + "." + BaseLabel)
+	if name == "" {
+		return
+	}
+
+	base := Get(name)
+	if base == nil || base == Pattern(p) {
+		p.log.Error().Str("base", name).Msg("pattern not usable")
+		return
+	}
+
+	go func() {
+		defer util.LogRecover()
+		// using the private runner otherwise, we'll get canceled! ;)
+		err := base.GetBase().runUnder(&p.BasePattern, p.ctx, p.log, "base")
+		if err != nil {
+			p.log.Err(err).Str("base", base.String()).Msg("pattern failed")
+		}
+	}()
+}
+
+func (p *LogwatchPattern) check(matches []*logMatch, line string) {
+	for _, m := range matches {
+		if !m.re.MatchString(line) {
+			continue
+		}
+
+		p.log.Info().Str("match", m.String()).Str("line", line).Msg("alert")
+
+		p.alertMutex.Lock()
+		defer p.alertMutex.Unlock()
+
+		err := p.raiseAlert(m)
+		if err != nil {
+			p.log.Err(err).Msg("can't show alert")
+		}
+
+		return
+	}
+}
+
+// raiseAlert expects the alertMutex to be held
+func (p *LogwatchPattern) raiseAlert(m *logMatch) error {
+	if p.alert == m {
+		return nil
+	}
+
+	p.stopFlash()
+	p.alert = m
+
+	if !m.flash {
+		return p.overlay.SetColor(m.color)
+	}
+
+	var flashCtx context.Context
+	flashCtx, p.cancelFlash = context.WithCancel(p.ctx)
+	p.flashDone = make(chan struct{})
+	go p.flash(flashCtx, m.color, p.overlay.SetColor, p.flashDone)
+	return nil
+}
+
+// clearAlert expects the alertMutex to be held
+func (p *LogwatchPattern) clearAlert() error {
+	p.stopFlash()
+	p.alert = nil
+	return p.overlay.ClearColor()
+}
+
+// stopFlash waits for the flash goroutine to exit so that it can't set a color
+// after the alert is cleared or replaced
+func (p *LogwatchPattern) stopFlash() {
+	if p.cancelFlash != nil {
+		p.cancelFlash()
+		<-p.flashDone
+		p.cancelFlash = nil
+		p.flashDone = nil
+	}
+}
+
+func (p *LogwatchPattern) open(tf *tailedFile, whence int) error {
+	// never watch what the user running it couldn't read
+	f, err := openAsUser(tf.path)
+	if err != nil {
+		return err
+	}
+
+	tf.offset, err = f.Seek(0, whence)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	tf.file = f
+	tf.reader = bufio.NewReader(f)
+	tf.line = ""
+	p.log.Debug().Str("path", tf.path).Int64("offset", tf.offset).Msg("watching")
+	return nil
+}
+
+func (tf *tailedFile) close() {
+	if tf.file != nil {
+		tf.file.Close()
+		tf.file = nil
+	}
+}
+
+// readLines returns all complete lines appended since the last read.
+func (tf *tailedFile) readLines() []string {
+	if tf.file == nil {
+		return nil
+	}
+
+	if info, err := tf.file.Stat(); err == nil && info.Size() < tf.offset {
+		// truncated (e.g. copytruncate rotation): start over
+		tf.offset, _ = tf.file.Seek(0, io.SeekStart)
+		tf.reader.Reset(tf.file)
+		tf.line = ""
+	}
+
+	lines := []string{}
+	for {
+		chunk, err := tf.reader.ReadString('\n')
+		tf.offset += int64(len(chunk))
+		tf.line += chunk
+
+		if err != nil {
+			// partial line (or nothing): wait for more to be written
+			return lines
+		}
+
+		lines = append(lines, strings.TrimRight(tf.line, "\r\n"))
+		tf.line = ""
+	}
+}
+
+// expandHome will replace a leading "~/" with the home directory of the
+// invoking user.
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return filepath.Clean(path), nil
+	}
+
+	u, err := util.InvokingUser()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(u.HomeDir, strings.TrimPrefix(path, "~/")), nil
+}
+
+// expandUserPath resolves a path that must be within the invoking user's home
+// directory (where a relative path or one starting with "~/" is relative to
+// it), returning the user as well so that the file can be accessed as them.
+func expandUserPath(path string) (string, *user.User, error) {
+	u, err := util.InvokingUser()
+	if err != nil {
+		return "", nil, err
+	}
+
+	home := filepath.Clean(u.HomeDir)
+	path = strings.TrimPrefix(path, "~/")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(home, path)
+	}
+
+	path = filepath.Clean(path)
+	if !strings.HasPrefix(path, home+string(filepath.Separator)) {
+		return "", nil, fmt.Errorf("%s is not within the home directory of %s", path, u.Username)
+	}
+
+	return path, u, nil
+}
@@ -0,0 +1,229 @@
+package patterns
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+)
+
+// MorsePattern is used when blinking a text message as Morse code using either
+// the brightness or the color of the keyboard. The "delay" configuration value
+// expresses the length of one Morse unit (i.e. a "dot").
+type MorsePattern struct {
+	BasePattern
+}
+
+// MessageLabel is used to get the message to blink from configuration.
+const MessageLabel = "message"
+
+// LoopLabel is used to get whether to keep repeating the message from
+// configuration.
+const LoopLabel = "loop"
+
+// ModeLabel is used to get how the message is blinked (or how the desktop
+// picture's colors are shown) from configuration.
+const ModeLabel = "mode"
+
+// ColorLabel is used to get the "on" color from configuration.
+const ColorLabel = "color"
+
+// OffColorLabel is used to get the "off" color from configuration.
+const OffColorLabel = "off-color"
+
+const (
+	// BrightnessMode blinks by turning the keyboard brightness on and off.
+	BrightnessMode = "brightness"
+
+	// ColorMode blinks by switching between the "on" and "off" colors.
+	ColorMode = "color"
+)
+
+var _ Pattern = (*MorsePattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*MorsePattern)(nil) // ensures we conform to the runnable interface
+
+// String is a customized version of the BasePattern String that also includes
+// the message.
+func (p *MorsePattern) String() string {
+	return fmt.Sprintf("%s %s=%q", p.BasePattern.String(), MessageLabel, config.GetString(p.Name+"."+MessageLabel))
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// international morse code: https://www.itu.int/rec/R-REC-M.1677-1-200910-I/
+var morseCodes = map[rune]string{
+	'A': ".-", 'B': "-...", 'C': "-.-.", 'D': "-..", 'E': ".", 'F': "..-.",
+	'G': "--.", 'H': "....", 'I': "..", 'J': ".---", 'K': "-.-", 'L': ".-..",
+	'M': "--", 'N': "-.", 'O': "---", 'P': ".--.", 'Q': "--.-", 'R': ".-.",
+	'S': "...", 'T': "-", 'U': "..-", 'V': "...-", 'W': ".--", 'X': "-..-",
+	'Y': "-.--", 'Z': "--..",
+	'0': "-----", '1': ".----", '2': "..---", '3': "...--", '4': "....-",
+	'5': ".....", '6': "-....", '7': "--...", '8': "---..", '9': "----.",
+	'.': ".-.-.-", ',': "--..--", '?': "..--..", '\'': ".----.", '!': "-.-.--",
+	'/': "-..-.", '(': "-.--.", ')': "-.--.-", '&': ".-...", ':': "---...",
+	';': "-.-.-.", '=': "-...-", '+': ".-.-.", '-': "-....-", '_': "..--.-",
+	'"': ".-..-.", '$': "...-..-", '@': ".--.-.",
+}
+
+// a signal is a period of time, in units, that the keyboard is either on or off
+type signal struct {
+	on    bool
+	units int
+}
+
+func init() {
+	register("morse", &MorsePattern{}, 150*time.Millisecond)
+}
+
+func (p *MorsePattern) run() error {
+	message := config.GetString(p.Name + "." + MessageLabel)
+	signals := p.encode(message)
+	if len(signals) == 0 {
+		return fmt.Errorf("no message to blink: provide one with --%s", MessageLabel)
+	}
+
+	on, off, err := p.getSetters()
+	if err != nil {
+		return err
+	}
+
+	restore, err := p.getRestore()
+	if err != nil {
+		return err
+	}
+
+	// don't leave the keyboard dark (or off-colored) if stopped in the middle
+	// of a blink
+	defer restore()
+
+	for {
+		for _, sig := range signals {
+			if sig.on {
+				err = on()
+			} else {
+				err = off()
+			}
+
+			if err != nil {
+				return err
+			}
+
+			for i := 0; i < sig.units; i++ {
+				if p.cancelableSleep() {
+					return nil
+				}
+			}
+		}
+
+		if !config.GetBool(p.Name + "." + LoopLabel) {
+			return nil
+		}
+	}
+}
+
+func (p *MorsePattern) getSetters() (func() error, func() error, error) {
+	mode := config.GetString(p.Name + "." + ModeLabel)
+
+	switch mode {
+	case BrightnessMode:
+		on := func() error { return keyboard.BrightnessFileHandler("255") }
+		off := func() error { return keyboard.BrightnessFileHandler("0") }
+		return on, off, nil
+	case ColorMode:
+		onColor := config.GetString(p.Name + "." + ColorLabel)
+		offColor := config.GetString(p.Name + "." + OffColorLabel)
+		for _, c := range []string{onColor, offColor} {
+			if _, err := keyboard.ParseColor(c); err != nil {
+				return nil, nil, err
+			}
+		}
+		on := func() error { return keyboard.ColorFileHandler(onColor) }
+		off := func() error { return keyboard.ColorFileHandler(offColor) }
+		return on, off, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown %s mode: %s", p.Name, mode)
+}
+
+// getRestore captures what the mode changes so it can be put back once done
+func (p *MorsePattern) getRestore() (func() error, error) {
+	if config.GetString(p.Name+"."+ModeLabel) == ColorMode {
+		colors, err := keyboard.GetCurrentColors()
+		if err != nil {
+			return nil, err
+		}
+
+		var color string
+		for _, v := range colors {
+			// the blinks set all groups to the same color so simply grab the first one
+			color = v
+			break
+		}
+
+		return func() error {
+			if color == "" {
+				return nil
+			}
+			return keyboard.ColorFileHandler(color)
+		}, nil
+	}
+
+	brightness, err := keyboard.GetCurrentBrightness()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error { return keyboard.BrightnessFileHandler(brightness) }, nil
+}
+
+// encode converts the message into the standard morse timing: dots are one unit,
+// dashes are three, with one unit between parts of a letter, three between
+// letters, and seven between words (including before the message repeats)
+func (p *MorsePattern) encode(message string) []signal {
+	signals := []signal{}
+
+	gap := func(units int) {
+		last := len(signals) - 1
+		if last < 0 {
+			return
+		}
+		if !signals[last].on {
+			if signals[last].units < units {
+				signals[last].units = units
+			}
+			return
+		}
+		signals = append(signals, signal{on: false, units: units})
+	}
+
+	for _, r := range strings.ToUpper(message) {
+		if unicode.IsSpace(r) {
+			gap(7)
+			continue
+		}
+
+		code, ok := morseCodes[r]
+		if !ok {
+			p.log.Warn().Str("char", string(r)).Msg("ignoring character without a morse code")
+			continue
+		}
+
+		gap(3)
+		for i, c := range code {
+			if i > 0 {
+				gap(1)
+			}
+			units := 1
+			if c == '-' {
+				units = 3
+			}
+			signals = append(signals, signal{on: true, units: units})
+		}
+	}
+
+	gap(7)
+	return signals
+}
@@ -7,10 +7,13 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BitPonyLLC/huekeys/pkg/events"
+	"github.com/BitPonyLLC/huekeys/pkg/input"
 	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -27,14 +30,21 @@ type Pattern interface {
 
 // Config is the expected interface for retrieving configuration values.
 type Config interface {
+	Get(string) interface{}
 	GetBool(string) bool
 	GetDuration(string) time.Duration
+	GetFloat64(string) float64
+	GetInt(string) int
 	GetString(string) string
+	GetStringMapString(string) map[string]string
+	GetStringSlice(string) []string
 }
 
-// ChangeEvent is an event that is emitted when the running pattern is changed.
+// ChangeEvent is an event that is emitted when the running pattern is changed,
+// including when its idle pattern starts or stops.
 type ChangeEvent struct {
 	Pattern string
+	Idle    string // name of the idle pattern running (if any)
 }
 
 // BasePattern is part of all patterns that provides common attributes and implementation.
@@ -47,11 +57,28 @@ type BasePattern struct {
 
 	defaultDelay  time.Duration
 	stopRequested bool
+
+	held     chan struct{} // closed when no longer held by an idle pattern
+	releases int32         // number of times an idle pattern has stopped
+	idle     Pattern       // the idle pattern running (if any)
+	holder   *BasePattern  // the pattern running this one whose hold also applies (if any)
+	shown    shownState    // what was last written with the write helpers
 }
 
 // DelayLabel is used to get the pattern delay from configuration.
 const DelayLabel = "delay"
 
+// IdleLabel is used to get the idle pattern from configuration.
+const IdleLabel = "idle"
+
+// IdlePeriodLabel is used to get the idle period from configuration.
+const IdlePeriodLabel = "idle-period"
+
+// DefaultIdlePeriod is the amount of time a pattern will wait before declaring
+// idle and, if configured, holding itself while running its idle pattern until
+// input is received again.
+const DefaultIdlePeriod = 30 * time.Second
+
 // Events are where Watchers can be created and ChangeEvents are emitted.
 var Events = &events.Manager{}
 
@@ -84,8 +111,9 @@ func GetRunning() Pattern {
 // Run will begin executing a pattern. If the context passed in is canceled, the
 // running pattern will stop.
 func (p *BasePattern) Run(parent context.Context, log *zerolog.Logger) error {
-	// first, turn keyboard on if it's off...
-	brightness, err := keyboard.GetCurrentBrightness()
+	// first, turn keyboard on if it's off (looking underneath any overlay, like
+	// the one toggling it off, so the brightness set before isn't lost)...
+	brightness, err := keyboard.GetBaseBrightness()
 	if err != nil {
 		return err
 	}
@@ -103,10 +131,57 @@ func (p *BasePattern) Run(parent context.Context, log *zerolog.Logger) error {
 	running = p.self
 	mutex.Unlock()
 
+	p.setHolder(nil)
+
 	Events.Emit(ChangeEvent{Pattern: p.Name})
+
+	idlePattern := p.getIdlePattern()
+	if idlePattern != nil {
+		go p.watchIdle(cancelCtx, idlePattern)
+	}
+
 	return p.rawRun(cancelCtx, log, "pattern")
 }
 
+// SupportsIdle determines if the pattern can run an idle pattern (i.e. it isn't
+// a special case like wait or watch).
+func (p *BasePattern) SupportsIdle() bool {
+	return p.self != nil
+}
+
+// RunsUserCode determines if the pattern runs commands or scripts provided by
+// the invoking user (i.e. only that user should be allowed to start it).
+func (p *BasePattern) RunsUserCode() bool {
+	switch p.self.(type) {
+	case *ExecPattern, *ScriptPattern:
+		return true
+	}
+	return false
+}
+
+// IdlePattern returns the idle pattern currently running in place of this one,
+// or nil if not idle.
+func (p *BasePattern) IdlePattern() Pattern {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+
+	return p.idle
+}
+
+// ActivitySelector chooses the input devices showing someone is present: the
+// keyboards selected by the typing configuration along with any other idle
+// devices configured (e.g. touchpads).
+func ActivitySelector() (input.Selector, error) {
+	specs := config.GetStringSlice("typing." + DevicesLabel)
+	specs = append(specs, config.GetString("typing."+InputEventIDLabel))
+	if len(specs) == 1 && specs[0] == "" {
+		specs = append(specs, input.DefaultDeviceMatch)
+	}
+	specs = append(specs, config.GetStringSlice(IdleLabel+"."+DevicesLabel)...)
+
+	return input.NewSelector(specs...)
+}
+
 // Stop will terminate the currently running pattern.
 func (p *BasePattern) Stop() {
 	mutex.Lock()
@@ -118,12 +193,41 @@ func (p *BasePattern) Stop() {
 	mutex.Unlock()
 }
 
+// Pause will hold the running pattern (and any it is running underneath) at its
+// next update until Resume is called.
+func Pause() {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+
+	if resumed == nil {
+		resumed = make(chan struct{})
+	}
+}
+
+// Resume will continue any patterns held by Pause.
+func Resume() {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+
+	if resumed != nil {
+		close(resumed)
+		resumed = nil
+	}
+}
+
 // String will return a readable representation of the pattern.
 func (p *BasePattern) String() string {
-	if p.getDelay() == 0 {
-		return p.Name
+	str := p.Name
+	if p.getDelay() != 0 {
+		str += fmt.Sprintf(" %s=%s", DelayLabel, p.getDelay())
+	}
+
+	idlePattern := p.getIdlePattern()
+	if idlePattern != nil {
+		str += fmt.Sprintf(" %s=%s %s=%s", IdleLabel, idlePattern.GetBase().Name, IdlePeriodLabel, p.getIdlePeriod())
 	}
-	return fmt.Sprintf("%s %s=%s", p.Name, DelayLabel, p.getDelay())
+
+	return str
 }
 
 //--------------------------------------------------------------------------------
@@ -139,6 +243,9 @@ var running Pattern // only one allowed to be running at any given time, thus a
 var mutex sync.Mutex
 var cancel func()
 
+var pauseMutex sync.Mutex
+var resumed chan struct{} // closed when no longer paused
+
 var registeredPatterns = map[string]Pattern{}
 
 func register(name string, p Pattern, delay time.Duration) {
@@ -163,21 +270,328 @@ func (p *BasePattern) rawRun(parent context.Context, log *zerolog.Logger, logKey
 	p.log = &plog
 	p.log.Info().Msg("started")
 	defer p.log.Info().Msg("stopped")
+
+	// nothing is shown again for a pattern no longer running
+	defer func() {
+		pauseMutex.Lock()
+		p.shown = shownState{}
+		pauseMutex.Unlock()
+	}()
+
 	return p.self.run()
 }
 
+// runUnder runs the pattern on behalf of another (e.g. a rule's pattern), held
+// along with it
+func (p *BasePattern) runUnder(holder *BasePattern, parent context.Context, log *zerolog.Logger, logKey string) error {
+	p.setHolder(holder)
+	return p.rawRun(parent, log, logKey)
+}
+
+func (p *BasePattern) setHolder(holder *BasePattern) {
+	pauseMutex.Lock()
+	p.holder = holder
+	pauseMutex.Unlock()
+}
+
 func (p *BasePattern) cancelableSleep() bool {
-	wake := time.NewTimer(p.getDelay())
+	return p.cancelableSleepFor(p.getDelay())
+}
+
+func (p *BasePattern) cancelableSleepFor(delay time.Duration) bool {
+	wake := time.NewTimer(delay)
 	select {
 	case <-p.ctx.Done():
 		wake.Stop()
 		p.stopRequested = true
 		return true
 	case <-wake.C:
-		return false
+	}
+
+	return p.awaitRelease()
+}
+
+// awaitRelease waits while the pattern (or the one running it) is held by an
+// idle pattern or while paused, returning true if stopped instead.
+func (p *BasePattern) awaitRelease() bool {
+	if p.awaitReleaseUntil(p.ctx) {
+		p.stopRequested = true
+		return true
+	}
+
+	return false
+}
+
+// awaitReleaseUntil is awaitRelease for goroutines other than the one running
+// the pattern, returning true once ctx is done (without noting a stop request).
+func (p *BasePattern) awaitReleaseUntil(ctx context.Context) bool {
+	pauseMutex.Lock()
+	waits := []chan struct{}{p.held, resumed}
+	if p.holder != nil {
+		waits = append(waits, p.holder.held)
+	}
+	pauseMutex.Unlock()
+
+	for _, wait := range waits {
+		if wait == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return true
+		case <-wait:
+		}
+	}
+
+	return false
+}
+
+// flash toggles between the color and black using set until ctx is done,
+// closing done once it has exited. The "flash-delay" configuration value
+// expresses the amount of time between toggles.
+func (p *BasePattern) flash(ctx context.Context, color string, set func(string) error, done chan struct{}) {
+	defer close(done)
+	defer util.LogRecover()
+
+	delay := config.GetDuration(p.Name + "." + FlashDelayLabel)
+	if delay <= 0 {
+		delay = DefaultFlashDelay
+	}
+
+	colors := []string{color, "000000"}
+	for i := 0; ; i++ {
+		err := set(colors[i%2])
+		if err != nil {
+			p.log.Err(err).Msg("can't set flash color")
+			return
+		}
+
+		wake := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			wake.Stop()
+			return
+		case <-wake.C:
+		}
+	}
+}
+
+// shownState is what a pattern last wrote to the keyboard, so that it can be
+// shown again once an idle pattern stops.
+type shownState struct {
+	color      string
+	zones      map[string]string
+	brightness string
+}
+
+// writeColor writes a color, first waiting while the pattern is held or paused.
+// Patterns driven by events (rather than cancelableSleep) write with these
+// helpers so they never write over an idle pattern running in their place.
+func (p *BasePattern) writeColor(color string) error {
+	pauseMutex.Lock()
+	p.shown.color = color
+	p.shown.zones = nil // every zone is now this color
+	pauseMutex.Unlock()
+
+	if p.awaitRelease() {
+		return nil
+	}
+
+	return keyboard.ColorFileHandler(color)
+}
+
+// writeZoneColor writes the color of one zone, first waiting while the pattern
+// is held or paused (see writeColor).
+func (p *BasePattern) writeZoneColor(zone, color string) error {
+	pauseMutex.Lock()
+	if p.shown.zones == nil {
+		p.shown.zones = map[string]string{}
+	}
+	p.shown.zones[zone] = color
+	pauseMutex.Unlock()
+
+	if p.awaitRelease() {
+		return nil
+	}
+
+	return keyboard.ZoneColorFileHandler(zone, color)
+}
+
+// writeBrightness writes the brightness, first waiting while the pattern is held
+// or paused (see writeColor).
+func (p *BasePattern) writeBrightness(brightness string) error {
+	pauseMutex.Lock()
+	p.shown.brightness = brightness
+	pauseMutex.Unlock()
+
+	if p.awaitRelease() {
+		return nil
+	}
+
+	return keyboard.BrightnessFileHandler(brightness)
+}
+
+// showAgain writes whatever the pattern (and any it is running) last wrote with
+// the helpers above, replacing what an idle pattern left behind
+func (p *BasePattern) showAgain() {
+	pauseMutex.Lock()
+	states := []shownState{}
+	for _, pattern := range registeredPatterns {
+		base := pattern.GetBase()
+		if base == p || base.holder == p {
+			state := base.shown
+			state.zones = map[string]string{}
+			for zone, color := range base.shown.zones {
+				state.zones[zone] = color
+			}
+			states = append(states, state)
+		}
+	}
+	pauseMutex.Unlock()
+
+	for _, state := range states {
+		if state.color != "" {
+			keyboard.ColorFileHandler(state.color)
+		}
+
+		for zone, color := range state.zones {
+			keyboard.ZoneColorFileHandler(zone, color)
+		}
+
+		if state.brightness != "" {
+			keyboard.BrightnessFileHandler(state.brightness)
+		}
 	}
 }
 
 func (p *BasePattern) getDelay() time.Duration {
 	return config.GetDuration(p.Name + "." + DelayLabel)
 }
+
+func (p *BasePattern) getIdlePattern() Pattern {
+	if !p.SupportsIdle() {
+		return nil
+	}
+
+	name := config.GetString(p.Name + "." + IdleLabel)
+	if name == "" {
+		return nil
+	}
+
+	idlePattern := Get(name)
+	if idlePattern == nil || idlePattern.GetBase() == p || !idlePattern.GetBase().SupportsIdle() {
+		p.log.Error().Str("idle", name).Msg("pattern not usable")
+		return nil
+	}
+
+	return idlePattern
+}
+
+func (p *BasePattern) getIdlePeriod() time.Duration {
+	period := config.GetDuration(p.Name + "." + IdlePeriodLabel)
+	if period <= 0 {
+		period = DefaultIdlePeriod
+	}
+	return period
+}
+
+// watchIdle will hold the pattern and run the idle pattern in its place whenever
+// the idle period passes without any input, stopping it with the next input
+func (p *BasePattern) watchIdle(ctx context.Context, idlePattern Pattern) {
+	defer util.LogRecover()
+
+	selects, err := ActivitySelector()
+	if err != nil {
+		p.log.Err(err).Msg("can't watch for idle")
+		return
+	}
+
+	watcher, err := input.Watch(ctx, p.log, selects)
+	if err != nil {
+		p.log.Err(err).Msg("can't watch for idle")
+		return
+	}
+
+	var stopIdle func() // cancels the idle pattern and waits for it to stop
+	defer func() {
+		if stopIdle != nil {
+			stopIdle()
+			p.setIdle(nil)
+		}
+	}()
+
+	period := p.getIdlePeriod()
+	lastInput := time.Now()
+	for {
+		wait := period - time.Since(lastInput)
+		if stopIdle != nil || wait <= 0 {
+			wait = period // nothing to do until input arrives
+		}
+
+		check := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			check.Stop()
+			return
+		case ev := <-watcher.Events:
+			check.Stop()
+			if !ev.IsActivity() {
+				continue
+			}
+
+			lastInput = ev.Time
+			if stopIdle != nil {
+				p.log.Debug().Msg("no longer idle")
+				stopIdle()
+				stopIdle = nil
+				p.setIdle(nil)
+				p.showAgain()
+			}
+		case <-check.C:
+			if stopIdle != nil || time.Since(lastInput) < period {
+				continue
+			}
+
+			p.log.Debug().Msg("idle")
+			idleCtx, cancel := context.WithCancel(ctx)
+			idleDone := make(chan struct{})
+			stopIdle = func() {
+				cancel()
+				<-idleDone
+			}
+			p.setIdle(idlePattern)
+
+			go func() {
+				defer close(idleDone)
+				defer util.LogRecover()
+				// using the private runner otherwise, we'll get canceled! ;)
+				idlePattern.GetBase().setHolder(nil)
+				err := idlePattern.GetBase().rawRun(idleCtx, p.log, "idle")
+				if err != nil {
+					p.log.Err(err).Str("idle", idlePattern.String()).Msg("pattern failed")
+				}
+			}()
+		}
+	}
+}
+
+// setIdle holds the pattern while an idle pattern runs or releases it when nil
+func (p *BasePattern) setIdle(idlePattern Pattern) {
+	pauseMutex.Lock()
+	p.idle = idlePattern
+	if idlePattern != nil {
+		p.held = make(chan struct{})
+	} else if p.held != nil {
+		close(p.held)
+		p.held = nil
+		atomic.AddInt32(&p.releases, 1)
+	}
+	pauseMutex.Unlock()
+
+	change := ChangeEvent{Pattern: p.Name}
+	if idlePattern != nil {
+		change.Idle = idlePattern.GetBase().Name
+	}
+	Events.Emit(change)
+}
@@ -0,0 +1,360 @@
+package patterns
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/input"
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+)
+
+// ReactivePattern is used when briefly lighting up the keyboard for every key
+// pressed, fading back over the "decay" period. Keys are mapped to the zones of
+// multi-zone keyboards through a layout table so that, for example, typing on
+// the left side lights the left zone. With "ripple" enabled, each press also
+// spreads outward to the neighboring zones. The "delay" configuration value
+// expresses the amount of time to wait between updates of the fading effect.
+type ReactivePattern struct {
+	BasePattern
+
+	mutex sync.Mutex
+	hits  []zoneHit
+}
+
+// EffectLabel is used to get what is changed by a key press from
+// configuration.
+const EffectLabel = "effect"
+
+// KeyColorLabel is used to get the color shown for a key press from
+// configuration.
+const KeyColorLabel = "key-color"
+
+// DecayLabel is used to get how long a key press takes to fade from
+// configuration.
+const DecayLabel = "decay"
+
+// RippleLabel is used to get whether key presses spread to neighboring zones
+// from configuration.
+const RippleLabel = "ripple"
+
+// LayoutLabel is used to get the key code to zone layout table from
+// configuration.
+const LayoutLabel = "layout"
+
+const (
+	// ColorEffect fades each key press from the key color to the base color.
+	ColorEffect = "color"
+
+	// BrightnessEffect bumps the brightness up for each key press.
+	BrightnessEffect = "brightness"
+)
+
+// DefaultDecay is the amount of time a key press takes to fade away.
+const DefaultDecay = 500 * time.Millisecond
+
+// ZoneOrder is the physical order of the keyboard zones from left to right,
+// used when rippling key presses outward.
+var ZoneOrder = []string{"left", "center", "right", "extra"}
+
+var _ Pattern = (*ReactivePattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*ReactivePattern)(nil) // ensures we conform to the runnable interface
+
+// String is a customized version of the BasePattern String that also includes
+// the effect settings.
+func (p *ReactivePattern) String() string {
+	return fmt.Sprintf("%s %s=%s %s=%s", p.BasePattern.String(),
+		EffectLabel, config.GetString(p.Name+"."+EffectLabel),
+		DecayLabel, config.GetDuration(p.Name+"."+DecayLabel))
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// zoneHit is a key press lighting a zone (possibly in the future, when rippling)
+type zoneHit struct {
+	zone string
+	at   time.Time
+}
+
+// defaultLayout maps key codes of a typical US layout to zones
+// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L64
+var defaultLayout = map[string]string{
+	"left":   "1-6,15-20,29-34,41-42,44-48,56,58-62,125",
+	"center": "7-11,21-25,35-38,49-53,57,63-66",
+	"right":  "12-14,26-28,39-40,43,54,67-68,87-88,97,100-111,127",
+	"extra":  "55,69-83,96,98",
+}
+
+func init() {
+	register("reactive", &ReactivePattern{}, 20*time.Millisecond)
+}
+
+func (p *ReactivePattern) run() error {
+	layout, err := p.getLayout()
+	if err != nil {
+		return err
+	}
+
+	decay := config.GetDuration(p.Name + "." + DecayLabel)
+	if decay <= 0 {
+		decay = DefaultDecay
+	}
+
+	set, err := p.getSetter()
+	if err != nil {
+		return err
+	}
+
+	// leave everything as it was before any key presses
+	defer set(nil)
+
+	watcher, err := p.watchKeyboards()
+	if err != nil {
+		return err
+	}
+
+	p.hits = nil
+	go p.processKeys(watcher, layout, decay)
+
+	for {
+		now := time.Now()
+		levels := map[string]float64{}
+
+		p.mutex.Lock()
+		active := p.hits[:0]
+		for _, hit := range p.hits {
+			elapsed := now.Sub(hit.at)
+			if elapsed >= decay {
+				continue // faded away
+			}
+
+			active = append(active, hit)
+			if elapsed >= 0 { // otherwise, the ripple hasn't arrived yet
+				levels[hit.zone] = math.Max(levels[hit.zone], 1-float64(elapsed)/float64(decay))
+			}
+		}
+		p.hits = active
+		p.mutex.Unlock()
+
+		err = set(levels)
+		if err != nil {
+			return err
+		}
+
+		if p.cancelableSleep() {
+			return nil
+		}
+	}
+}
+
+func (p *ReactivePattern) processKeys(watcher *input.Watcher, layout map[uint16]string, decay time.Duration) {
+	defer util.LogRecover()
+
+	zones := keyboard.GetZones()
+	ripple := config.GetBool(p.Name + "." + RippleLabel)
+
+	for {
+		var ev input.Event
+		select {
+		case <-p.ctx.Done():
+			return
+		case ev = <-watcher.Events:
+		}
+
+		if !ev.IsKeyPress() {
+			continue
+		}
+
+		p.mutex.Lock()
+		for zone, distance := range pressedZones(layout[ev.Code], zones, ripple) {
+			// ripples arrive at each neighbor a fraction of the decay later
+			p.hits = append(p.hits, zoneHit{zone: zone, at: ev.Time.Add(time.Duration(distance) * decay / 4)})
+		}
+		p.mutex.Unlock()
+	}
+}
+
+// pressedZones returns the zones lit by a key press along with their distance
+// from the zone of the key.
+func pressedZones(zone string, zones []string, ripple bool) map[string]int {
+	pressed := map[string]int{}
+
+	index := indexOf(ZoneOrder, zone)
+	if index < 0 || indexOf(zones, zone) < 0 {
+		// unknown key or a single zone keyboard: light everything
+		for _, z := range zones {
+			pressed[z] = 0
+		}
+		return pressed
+	}
+
+	pressed[zone] = 0
+	if !ripple {
+		return pressed
+	}
+
+	for _, z := range zones {
+		if i := indexOf(ZoneOrder, z); i >= 0 && i != index {
+			distance := i - index
+			if distance < 0 {
+				distance = -distance
+			}
+			pressed[z] = distance
+		}
+	}
+
+	return pressed
+}
+
+// getSetter returns a function that applies the level (0.0 to 1.0) of each zone
+// to the configured effect, only writing when the resulting values change
+func (p *ReactivePattern) getSetter() (func(map[string]float64) error, error) {
+	effect := config.GetString(p.Name + "." + EffectLabel)
+
+	if effect == BrightnessEffect {
+		base, err := keyboard.GetCurrentBrightness()
+		if err != nil {
+			return nil, err
+		}
+
+		baseLevel, err := strconv.Atoi(base)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse brightness %s: %w", base, err)
+		}
+
+		last := ""
+		return func(levels map[string]float64) error {
+			level := 0.0
+			for _, l := range levels {
+				level = math.Max(level, l)
+			}
+
+			brightness := strconv.Itoa(baseLevel + int(math.Round(float64(255-baseLevel)*level)))
+			if brightness == last {
+				return nil
+			}
+
+			last = brightness
+			return keyboard.BrightnessFileHandler(brightness)
+		}, nil
+	}
+
+	if effect != ColorEffect {
+		return nil, fmt.Errorf("unknown reactive effect: %s", effect)
+	}
+
+	baseColor, err := keyboard.ParseColor(config.GetString(p.Name + "." + ColorLabel))
+	if err != nil {
+		return nil, err
+	}
+
+	keyColor, err := keyboard.ParseColor(config.GetString(p.Name + "." + KeyColorLabel))
+	if err != nil {
+		return nil, err
+	}
+
+	zones := keyboard.GetZones()
+	last := map[string]string{}
+	return func(levels map[string]float64) error {
+		for _, zone := range zones {
+			color := baseColor.BlendPerceptual(keyColor, levels[zone]).GetColorInHex()
+			if last[zone] == color {
+				continue
+			}
+
+			err := keyboard.ZoneColorFileHandler(zone, color)
+			if err != nil {
+				return err
+			}
+
+			last[zone] = color
+		}
+
+		return nil
+	}, nil
+}
+
+// getLayout returns the zone of each key code, starting from the default layout
+// and replacing any zones provided by the configuration (e.g. left = "1-6,15").
+func (p *ReactivePattern) getLayout() (map[uint16]string, error) {
+	ranges := map[string]string{}
+	for zone, codes := range defaultLayout {
+		ranges[zone] = codes
+	}
+
+	for zone, codes := range config.GetStringMapString(p.Name + "." + LayoutLabel) {
+		if indexOf(ZoneOrder, zone) < 0 {
+			return nil, fmt.Errorf("unknown zone in %s: %s (expected one of %s)", LayoutLabel, zone, strings.Join(ZoneOrder, ", "))
+		}
+		ranges[zone] = codes
+	}
+
+	// apply zones in a stable order so overlapping codes are deterministic
+	zones := make([]string, 0, len(ranges))
+	for zone := range ranges {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	layout := map[uint16]string{}
+	for _, zone := range zones {
+		codes, err := parseCodeRanges(ranges[zone])
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %s for %s zone: %w", LayoutLabel, zone, err)
+		}
+
+		for _, code := range codes {
+			layout[code] = zone
+		}
+	}
+
+	return layout, nil
+}
+
+// parseCodeRanges converts a list of key codes and ranges (e.g. "1-6,15,29-34")
+// into the individual codes.
+func parseCodeRanges(val string) ([]uint16, error) {
+	codes := []uint16{}
+	for _, field := range strings.Split(val, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(field, "-")
+		if !isRange {
+			to = from
+		}
+
+		first, err := strconv.ParseUint(strings.TrimSpace(from), 10, 16)
+		if err != nil {
+			return nil, err
+		}
+
+		last, err := strconv.ParseUint(strings.TrimSpace(to), 10, 16)
+		if err != nil {
+			return nil, err
+		}
+
+		for code := first; code <= last; code++ {
+			codes = append(codes, uint16(code))
+		}
+	}
+
+	return codes, nil
+}
+
+func indexOf(list []string, val string) int {
+	for i, v := range list {
+		if v == val {
+			return i
+		}
+	}
+	return -1
+}
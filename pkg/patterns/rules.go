@@ -0,0 +1,218 @@
+package patterns
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/rules"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+)
+
+// RulesPattern is used when changing colors according to a prioritized list of
+// configured rules evaluated against system metrics. The "delay" configuration
+// value expresses the amount of time to wait between evaluations.
+type RulesPattern struct {
+	BasePattern
+
+	active       *rules.Rule
+	cancelAction context.CancelFunc
+	actionDone   chan struct{} // closed when the flash or sub-pattern has exited
+}
+
+// RuleLabel is used to get the list of rules from configuration.
+const RuleLabel = "rule"
+
+// SourcesLabel is used to get the custom metric sources from configuration.
+const SourcesLabel = "sources"
+
+// FlashDelayLabel is used to get the rate of flashing from configuration.
+const FlashDelayLabel = "flash-delay"
+
+// DefaultFlashDelay is the amount of time between toggles of a flashing rule.
+const DefaultFlashDelay = 500 * time.Millisecond
+
+var _ Pattern = (*RulesPattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*RulesPattern)(nil) // ensures we conform to the runnable interface
+
+func init() {
+	register("rules", &RulesPattern{}, 2*time.Second)
+}
+
+func (p *RulesPattern) run() error {
+	rs, err := p.loadRules()
+	if err != nil {
+		return err
+	}
+
+	sampler := rules.NewSampler(p.ctx, config.GetStringMapString(p.Name+"."+SourcesLabel))
+
+	p.active = nil
+	defer p.stopAction()
+
+	for {
+		sampler.Next()
+
+		rule, err := rs.Match(sampler)
+		if err != nil {
+			p.log.Warn().Err(err).Msg("skipped")
+		}
+
+		if rule != p.active {
+			err = p.apply(rule)
+			if err != nil {
+				return err
+			}
+		}
+
+		if p.cancelableSleep() {
+			return nil
+		}
+	}
+}
+
+func (p *RulesPattern) loadRules() (rules.Rules, error) {
+	var entries []interface{}
+
+	switch val := config.Get(p.Name + "." + RuleLabel).(type) {
+	case nil:
+		return nil, fmt.Errorf("no rules configured: add [[%s.%s]] entries to the configuration", p.Name, RuleLabel)
+	case []interface{}:
+		entries = val
+	case []map[string]interface{}:
+		for _, m := range val {
+			entries = append(entries, m)
+		}
+	default:
+		return nil, fmt.Errorf("can't parse rules configuration: %T", val)
+	}
+
+	rs := make(rules.Rules, 0, len(entries))
+	for i, entry := range entries {
+		m, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("can't parse rule %d: %T", i+1, entry)
+		}
+
+		rule := &rules.Rule{
+			Name:       configString(m, "name"),
+			When:       configString(m, "when"),
+			Color:      configString(m, "color"),
+			Brightness: configString(m, "brightness"),
+			Flash:      configString(m, "flash"),
+			Pattern:    configString(m, "pattern"),
+		}
+
+		if priority := configString(m, "priority"); priority != "" {
+			var err error
+			rule.Priority, err = strconv.Atoi(priority)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse priority of rule %s: %w", rule, err)
+			}
+		}
+
+		if rule.Pattern == p.Name {
+			return nil, fmt.Errorf("rule %s can't run the %s pattern", rule, p.Name)
+		}
+
+		err := rule.Compile()
+		if err != nil {
+			return nil, err
+		}
+
+		rs = append(rs, rule)
+	}
+
+	rs.Sort()
+	return rs, nil
+}
+
+func (p *RulesPattern) apply(rule *rules.Rule) error {
+	p.stopAction()
+	p.active = rule
+
+	if rule == nil {
+		p.log.Debug().Msg("no rule matched")
+		return nil
+	}
+
+	p.log.Info().Str("rule", rule.String()).Msg("matched")
+
+	if rule.Brightness != "" {
+		err := p.writeBrightness(rule.Brightness)
+		if err != nil {
+			return err
+		}
+	}
+
+	if rule.Color != "" {
+		err := p.writeColor(rule.Color)
+		if err != nil {
+			return err
+		}
+	}
+
+	if rule.Flash == "" && rule.Pattern == "" {
+		return nil
+	}
+
+	var sub Pattern
+	if rule.Flash == "" {
+		sub = Get(rule.Pattern)
+		if sub == nil {
+			return fmt.Errorf("rule %s has unknown pattern: %s", rule, rule.Pattern)
+		}
+	}
+
+	var actionCtx context.Context
+	actionCtx, p.cancelAction = context.WithCancel(p.ctx)
+	done := make(chan struct{})
+	p.actionDone = done
+
+	if rule.Flash != "" {
+		// runs alongside the rules loop so it mustn't note stop requests (i.e.
+		// via writeColor)
+		set := func(color string) error {
+			if p.awaitReleaseUntil(actionCtx) {
+				return nil
+			}
+			return keyboard.ColorFileHandler(color)
+		}
+
+		go p.flash(actionCtx, rule.Flash, set, done)
+		return nil
+	}
+
+	go func() {
+		defer close(done)
+		defer util.LogRecover()
+		// using the private runner otherwise, we'll get canceled! ;)
+		err := sub.GetBase().runUnder(&p.BasePattern, actionCtx, p.log, "rule")
+		if err != nil {
+			p.log.Err(err).Str("rule", rule.String()).Msg("pattern failed")
+		}
+	}()
+
+	return nil
+}
+
+// stopAction waits for the flash or sub-pattern of the active rule to exit so
+// that it can't overwrite what the next rule sets
+func (p *RulesPattern) stopAction() {
+	if p.cancelAction != nil {
+		p.cancelAction()
+		<-p.actionDone
+		p.cancelAction = nil
+		p.actionDone = nil
+	}
+}
+
+func configString(m map[string]interface{}, key string) string {
+	val, ok := m[key]
+	if !ok || val == nil {
+		return ""
+	}
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,402 @@
+package patterns
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/input"
+	"github.com/BitPonyLLC/huekeys/pkg/util"
+
+	"github.com/rs/zerolog/log"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// ScriptPattern is used when changing colors according to a Starlark script
+// (https://github.com/bazelbuild/starlark). Scripts are loaded from files with
+// a ".star" extension and may define a run() function, an on_key(code)
+// function, or both. The following builtins are available to scripts:
+//
+//	set_color(color, zone=None)  set the keyboard (or zone) color
+//	set_brightness(level)        set the keyboard brightness (0-255)
+//	sleep(seconds)               wait, delivering any key presses to on_key
+//	now()                        the current time in seconds since the epoch
+//	read_file(path)              the contents of a (small) readable file
+//	print(...)                   write a message to the log
+type ScriptPattern struct {
+	BasePattern
+
+	Path        string
+	Description string
+
+	keys        chan uint16
+	onKey       starlark.Callable
+	dispatching bool
+}
+
+// ScriptExt is the file extension of scripts loaded as patterns.
+const ScriptExt = ".star"
+
+// MaxScriptReadSize is the largest file scripts are allowed to read.
+const MaxScriptReadSize = 64 * 1024
+
+// MaxScriptSteps is the most computation steps a script may take without
+// sleeping (or between key presses), stopping scripts that never wait.
+const MaxScriptSteps = 10_000_000
+
+var _ Pattern = (*ScriptPattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*ScriptPattern)(nil) // ensures we conform to the runnable interface
+
+// LoadScripts will register a ScriptPattern for each script found in dir, named
+// after the script's file name. Scripts with names matching an already
+// registered pattern are skipped. A missing dir is not considered an error.
+func LoadScripts(dir string) ([]*ScriptPattern, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+ScriptExt))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	scripts := []*ScriptPattern{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ScriptExt)
+		if registeredPatterns[name] != nil {
+			log.Warn().Str("path", path).Str("name", name).Msg("ignoring script: pattern already exists")
+			continue
+		}
+
+		script := &ScriptPattern{Path: path, Description: scriptDescription(path)}
+		register(name, script, 0)
+		scripts = append(scripts, script)
+	}
+
+	return scripts, nil
+}
+
+// String is a customized version of the BasePattern String that also includes
+// the script's path.
+func (p *ScriptPattern) String() string {
+	return fmt.Sprintf("%s path=%s", p.BasePattern.String(), p.Path)
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// scripts are expected to loop (i.e. `while True:`) until stopped
+var scriptOptions = &syntax.FileOptions{While: true, Recursion: true}
+
+func (p *ScriptPattern) run() error {
+	// never load a script the user running it couldn't read
+	f, err := openAsUser(p.Path)
+	if err != nil {
+		return fmt.Errorf("can't read script: %w", err)
+	}
+
+	src, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("can't read script: %w", err)
+	}
+
+	thread := &starlark.Thread{
+		Name: p.Name,
+		Print: func(_ *starlark.Thread, msg string) {
+			p.log.Info().Str("script", p.Name).Msg(msg)
+		},
+	}
+
+	stopped := make(chan bool)
+	defer close(stopped)
+
+	go func() {
+		select {
+		case <-stopped:
+		case <-p.ctx.Done():
+			thread.Cancel("stopped")
+		}
+	}()
+
+	refillSteps(thread)
+	globals, err := starlark.ExecFileOptions(scriptOptions, thread, p.Path, src, p.builtins())
+	if err != nil {
+		return p.scriptErr(err)
+	}
+
+	p.keys = nil
+	p.onKey, _ = globals["on_key"].(starlark.Callable)
+	if p.onKey != nil {
+		err = p.watchKeys()
+		if err != nil {
+			return err
+		}
+	}
+
+	run, _ := globals["run"].(starlark.Callable)
+	if run != nil {
+		_, err = starlark.Call(thread, run, nil, nil)
+		if err != nil {
+			return p.scriptErr(err)
+		}
+	}
+
+	if p.onKey == nil {
+		return nil
+	}
+
+	// nothing left to do but wait for key presses
+	for {
+		select {
+		case <-p.ctx.Done():
+			p.stopRequested = true
+			return nil
+		case code := <-p.keys:
+			refillSteps(thread)
+			err = p.dispatchKey(thread, code)
+			if err != nil {
+				return p.scriptErr(err)
+			}
+		}
+	}
+}
+
+func (p *ScriptPattern) scriptErr(err error) error {
+	if p.ctx.Err() != nil {
+		// canceled by stop or another pattern starting
+		p.stopRequested = true
+		return nil
+	}
+
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("script failed: %s", evalErr.Backtrace())
+	}
+
+	return fmt.Errorf("script failed: %w", err)
+}
+
+func (p *ScriptPattern) watchKeys() error {
+	watcher, err := p.watchKeyboards()
+	if err != nil {
+		return err
+	}
+
+	p.keys = make(chan uint16, 32)
+
+	go func(keys chan<- uint16) {
+		defer util.LogRecover()
+		for {
+			var ev input.Event
+			select {
+			case <-p.ctx.Done():
+				return
+			case ev = <-watcher.Events:
+			}
+
+			if ev.IsKeyPress() {
+				select {
+				case keys <- ev.Code:
+				default:
+					// script isn't keeping up: drop the key press
+				}
+			}
+		}
+	}(p.keys)
+
+	return nil
+}
+
+func (p *ScriptPattern) dispatchKey(thread *starlark.Thread, code uint16) error {
+	if p.dispatching {
+		// don't recurse when on_key calls sleep
+		return nil
+	}
+
+	p.dispatching = true
+	defer func() { p.dispatching = false }()
+
+	_, err := starlark.Call(thread, p.onKey, starlark.Tuple{starlark.MakeInt(int(code))}, nil)
+	return err
+}
+
+func (p *ScriptPattern) builtins() starlark.StringDict {
+	return starlark.StringDict{
+		"set_color":      starlark.NewBuiltin("set_color", p.setColor),
+		"set_brightness": starlark.NewBuiltin("set_brightness", p.setBrightness),
+		"sleep":          starlark.NewBuiltin("sleep", p.sleep),
+		"now":            starlark.NewBuiltin("now", scriptNow),
+		"read_file":      starlark.NewBuiltin("read_file", p.readFile),
+	}
+}
+
+func (p *ScriptPattern) setColor(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var color string
+	var zone starlark.Value = starlark.None
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "color", &color, "zone?", &zone)
+	if err != nil {
+		return nil, err
+	}
+
+	color, err = normalizeColor(color)
+	if err != nil {
+		return nil, err
+	}
+
+	if zone == starlark.None {
+		err = p.writeColor(color)
+	} else {
+		zoneName, ok := starlark.AsString(zone)
+		if !ok {
+			return nil, fmt.Errorf("%s: zone must be a string", b.Name())
+		}
+		err = p.writeZoneColor(zoneName, color)
+	}
+
+	return starlark.None, err
+}
+
+func (p *ScriptPattern) setBrightness(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var level int
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "level", &level)
+	if err != nil {
+		return nil, err
+	}
+
+	if level < 0 || level > 255 {
+		return nil, fmt.Errorf("%s: level must be between 0 and 255", b.Name())
+	}
+
+	return starlark.None, p.writeBrightness(strconv.Itoa(level))
+}
+
+func (p *ScriptPattern) sleep(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seconds starlark.Value
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "seconds", &seconds)
+	if err != nil {
+		return nil, err
+	}
+
+	secs, ok := starlark.AsFloat(seconds)
+	if !ok || secs < 0 {
+		return nil, fmt.Errorf("%s: seconds must be a non-negative number", b.Name())
+	}
+
+	wake := time.NewTimer(time.Duration(secs * float64(time.Second)))
+	defer wake.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			p.stopRequested = true
+			return nil, p.ctx.Err()
+		case <-wake.C:
+			refillSteps(thread)
+			return starlark.None, nil
+		case code := <-p.keys: // never ready without on_key (nil channel)
+			err = p.dispatchKey(thread, code)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func scriptNow(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	err := starlark.UnpackArgs(b.Name(), args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Float(float64(time.Now().UnixNano()) / float64(time.Second)), nil
+}
+
+func (p *ScriptPattern) readFile(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path)
+	if err != nil {
+		return nil, err
+	}
+
+	// never let a script read what the user running it couldn't
+	f, err := openAsUser(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, MaxScriptReadSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.String(data), nil
+}
+
+// refillSteps allows the script another MaxScriptSteps until it next waits
+func refillSteps(thread *starlark.Thread) {
+	thread.SetMaxExecutionSteps(thread.ExecutionSteps() + MaxScriptSteps)
+}
+
+// checkUserCanReadPath ensures the invoking user could read a file when run as
+// root (i.e. never show what the user running it couldn't see).
+func checkUserCanReadPath(path string) error {
+	f, err := openAsUser(path)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// openAsUser opens a file for reading with the permissions of the invoking user
+// when run as root (including their permission to search each directory in the
+// path).
+func openAsUser(path string) (*os.File, error) {
+	if os.Getuid() != 0 {
+		return os.Open(path)
+	}
+
+	u, err := util.InvokingUser()
+	if err != nil {
+		return nil, err
+	}
+
+	var f *os.File
+	err = util.AsUser(u, func() error {
+		var err error
+		f, err = os.Open(path)
+		return err
+	})
+
+	return f, err
+}
+
+// scriptDescription returns the text of the first comment in the script, if
+// any, for use as the pattern's description.
+func scriptDescription(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		return strings.TrimSpace(strings.TrimLeft(line, "#"))
+	}
+
+	return ""
+}
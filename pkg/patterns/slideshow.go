@@ -0,0 +1,237 @@
+package patterns
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/internal/image_matcher"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SlideshowPattern is used when setting colors according to the pictures in a
+// directory, showing the dominant color of each in turn (chosen the same way as
+// for the DesktopPattern). The "delay" configuration value expresses the amount
+// of time each picture is shown.
+type SlideshowPattern struct {
+	BasePattern
+}
+
+// DirectoryLabel is used to get the directory of pictures from configuration.
+const DirectoryLabel = "directory"
+
+// ShuffleLabel is used to get whether pictures are shown in a random order
+// (instead of by name) from configuration.
+const ShuffleLabel = "shuffle"
+
+var _ Pattern = (*SlideshowPattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*SlideshowPattern)(nil) // ensures we conform to the runnable interface
+
+//--------------------------------------------------------------------------------
+// private
+
+// the time allowed for a picture added to the directory to be written
+const slideshowSettleDelay = time.Second
+
+func init() {
+	register("slideshow", &SlideshowPattern{}, time.Minute)
+}
+
+func (p *SlideshowPattern) run() error {
+	dir := config.GetString(p.Name + "." + DirectoryLabel)
+	if dir == "" {
+		return fmt.Errorf("no directory of pictures: provide it with --%s", DirectoryLabel)
+	}
+
+	dir, err := expandHome(dir)
+	if err != nil {
+		return err
+	}
+
+	if err = checkUserCanReadPath(dir); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("can't create directory watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	err = watcher.Add(dir)
+	if err != nil {
+		return fmt.Errorf("can't watch %s: %w", dir, err)
+	}
+
+	current := ""
+	shown := map[string]bool{}
+
+	settle := time.NewTimer(slideshowSettleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		current = p.showNext(dir, current, shown)
+
+		// wait for the next picture, skipping ahead when there was nothing to
+		// show or the one shown is removed
+		var next <-chan time.Time
+		var nextTimer *time.Timer
+		if current != "" {
+			nextTimer = time.NewTimer(p.getDelay())
+			next = nextTimer.C
+		}
+
+		stopped := false
+		for waiting := true; waiting; {
+			select {
+			case <-p.ctx.Done():
+				stopped = true
+				waiting = false
+			case err := <-watcher.Errors:
+				p.log.Warn().Err(err).Msg("directory watcher failed")
+			case ev := <-watcher.Events:
+				if !image_matcher.IsPicture(ev.Name) {
+					continue
+				}
+
+				removed := ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && filepath.Clean(ev.Name) == current
+				if current == "" || removed {
+					settle.Reset(slideshowSettleDelay)
+				}
+			case <-settle.C:
+				waiting = false
+			case <-next:
+				waiting = false
+			}
+		}
+
+		if nextTimer != nil {
+			nextTimer.Stop()
+		}
+
+		if stopped {
+			p.stopRequested = true
+			return nil
+		}
+
+		// honor any pause or hold by the idle pattern before moving on
+		if p.cancelableSleepFor(0) {
+			return nil
+		}
+	}
+}
+
+// showNext sets the color of the picture after the current one (or a random
+// one not yet shown in this pass when shuffled), returning the one shown (or
+// empty if none could be).
+func (p *SlideshowPattern) showNext(dir, current string, shown map[string]bool) string {
+	pictures, err := p.pictures(dir)
+	if err != nil {
+		p.log.Warn().Err(err).Msg("can't list pictures")
+		return ""
+	}
+
+	if len(pictures) == 0 {
+		p.log.Warn().Str("dir", dir).Msg("no pictures found")
+		return ""
+	}
+
+	shuffle := config.GetBool(p.Name + "." + ShuffleLabel)
+
+	// try each of them at most once, skipping those that can't be shown
+	for range pictures {
+		var path string
+		if shuffle {
+			path = nextShuffled(pictures, shown)
+		} else {
+			path = nextOrdered(pictures, current)
+		}
+
+		current = path
+		if shuffle {
+			shown[path] = true
+		}
+
+		err = p.setColorFrom(path)
+		if err == nil {
+			return path
+		}
+
+		p.log.Warn().Err(err).Str("path", path).Msg("can't show picture")
+	}
+
+	return ""
+}
+
+func (p *SlideshowPattern) setColorFrom(path string) error {
+	if err := checkUserCanReadPath(path); err != nil {
+		return err
+	}
+
+	color, err := image_matcher.GetDominantColorOf(path, Get("desktop").(*DesktopPattern).MatchOptions())
+	if err != nil {
+		return fmt.Errorf("can't determine dominant color: %w", err)
+	}
+
+	p.log.Info().Str("color", color).Str("path", path).Msg("setting")
+
+	return p.writeColor(color)
+}
+
+// pictures returns the paths of the pictures in a directory sorted by name
+func (p *SlideshowPattern) pictures(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pictures := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && image_matcher.IsPicture(entry.Name()) {
+			pictures = append(pictures, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	sort.Strings(pictures)
+	return pictures, nil
+}
+
+// nextOrdered returns the picture sorted after the current one (wrapping
+// around to the first)
+func nextOrdered(pictures []string, current string) string {
+	i := sort.SearchStrings(pictures, current)
+	if i < len(pictures) && pictures[i] == current {
+		i++
+	}
+
+	if i == len(pictures) {
+		i = 0
+	}
+
+	return pictures[i]
+}
+
+// nextShuffled returns a random picture not yet shown, starting a new pass once
+// all of them have been
+func nextShuffled(pictures []string, shown map[string]bool) string {
+	remaining := []string{}
+	for _, path := range pictures {
+		if !shown[path] {
+			remaining = append(remaining, path)
+		}
+	}
+
+	if len(remaining) == 0 {
+		for path := range shown {
+			delete(shown, path)
+		}
+		remaining = pictures
+	}
+
+	return remaining[rand.Intn(len(remaining))]
+}
@@ -0,0 +1,145 @@
+package patterns
+
+import (
+	"strconv"
+
+	"github.com/BitPonyLLC/huekeys/internal/desktop"
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+)
+
+// ThemePattern is used when setting colors according to the system accent color
+// of the desktop (e.g. GNOME 47+ or KDE Plasma), changing the brightness (and
+// optionally the color) when the desktop switches between light and dark. The
+// desktop is found the same way as for the DesktopPattern.
+type ThemePattern struct {
+	BasePattern
+}
+
+// LightColorLabel is used to get the color used instead of the accent color
+// when the desktop is light (the accent color is used when empty).
+const LightColorLabel = "light-color"
+
+// DarkColorLabel is used to get the color used instead of the accent color when
+// the desktop is dark (the accent color is used when empty).
+const DarkColorLabel = "dark-color"
+
+// LightBrightnessLabel is used to get the keyboard brightness used when the
+// desktop is light (left alone when negative).
+const LightBrightnessLabel = "light-brightness"
+
+// DarkBrightnessLabel is used to get the keyboard brightness used when the
+// desktop is dark (left alone when negative).
+const DarkBrightnessLabel = "dark-brightness"
+
+// FallbackColorLabel is used to get the color used when the desktop has no
+// accent color.
+const FallbackColorLabel = "fallback"
+
+// DefaultLightBrightness is the default keyboard brightness used when the
+// desktop is light.
+const DefaultLightBrightness = 255
+
+// DefaultDarkBrightness is the default keyboard brightness used when the
+// desktop is dark.
+const DefaultDarkBrightness = 96
+
+// DefaultFallbackColor is the default color used when the desktop has no accent
+// color (GNOME's default blue accent).
+const DefaultFallbackColor = "3584E4"
+
+var _ Pattern = (*ThemePattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*ThemePattern)(nil) // ensures we conform to the runnable interface
+
+//--------------------------------------------------------------------------------
+// private
+
+func init() {
+	register("theme", &ThemePattern{}, 0)
+}
+
+func (p *ThemePattern) run() error {
+	env, err := Get("desktop").(*DesktopPattern).sessionEnv()
+	if err != nil {
+		return err
+	}
+
+	source, err := desktop.NewTheme(config.GetString(p.Name+"."+SourceLabel), env)
+	if err != nil {
+		return err
+	}
+
+	theme, err := source.Theme()
+	if err != nil {
+		return err
+	}
+
+	err = p.apply(theme)
+	if err != nil {
+		return err
+	}
+
+	changes := make(chan desktop.Theme)
+	err = desktop.WatchTheme(p.ctx, p.log, source, func(theme desktop.Theme) {
+		select {
+		case changes <- theme:
+		case <-p.ctx.Done():
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			p.stopRequested = true
+			return nil
+		case theme = <-changes:
+		}
+
+		err = p.apply(theme)
+		if err != nil {
+			p.log.Err(err).Msg("can't apply theme")
+		}
+	}
+}
+
+func (p *ThemePattern) apply(theme desktop.Theme) error {
+	colorLabel, brightnessLabel := LightColorLabel, LightBrightnessLabel
+	if theme.Dark {
+		colorLabel, brightnessLabel = DarkColorLabel, DarkBrightnessLabel
+	}
+
+	color := config.GetString(p.Name + "." + colorLabel)
+	if color == "" {
+		color = theme.Accent
+	}
+	if color == "" {
+		color = config.GetString(p.Name + "." + FallbackColorLabel)
+	}
+
+	p.log.Info().Str("color", color).Bool("dark", theme.Dark).Msg("setting")
+
+	if color != "" {
+		rgb, err := keyboard.ParseColor(color)
+		if err != nil {
+			return err
+		}
+
+		err = p.writeColor(rgb.GetColorInHex())
+		if err != nil {
+			return err
+		}
+	}
+
+	brightness := config.GetInt(p.Name + "." + brightnessLabel)
+	if brightness < 0 {
+		return nil
+	}
+
+	if brightness > 255 {
+		brightness = 255
+	}
+
+	return p.writeBrightness(strconv.Itoa(brightness))
+}
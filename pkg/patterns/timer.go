@@ -0,0 +1,315 @@
+package patterns
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/notify"
+)
+
+// TimerPattern is used when counting down a duration by sweeping the keyboard
+// from one color to another (or by dimming the brightness), flashing when the
+// time expires. Optionally, it will cycle through pomodoro work and break
+// periods. The "delay" configuration value expresses the amount of time to wait
+// between updates.
+type TimerPattern struct {
+	BasePattern
+
+	mutex     sync.Mutex
+	phase     string
+	remaining time.Duration
+	paused    bool
+	skipped   bool
+	worked    int
+
+	lastColor      string
+	lastBrightness string
+}
+
+// DurationLabel is used to get the timer duration from configuration.
+const DurationLabel = "duration"
+
+// FromColorLabel is used to get the starting color from configuration.
+const FromColorLabel = "from-color"
+
+// ToColorLabel is used to get the ending color from configuration.
+const ToColorLabel = "to-color"
+
+// BreakColorLabel is used to get the starting color of pomodoro breaks from
+// configuration.
+const BreakColorLabel = "break-color"
+
+// DimLabel is used to get whether to dim the brightness (instead of sweeping
+// colors) from configuration.
+const DimLabel = "dim"
+
+// PomodoroLabel is used to get whether to cycle through pomodoro periods from
+// configuration.
+const PomodoroLabel = "pomodoro"
+
+// WorkLabel is used to get the pomodoro work period from configuration.
+const WorkLabel = "work"
+
+// ShortBreakLabel is used to get the pomodoro short break period from
+// configuration.
+const ShortBreakLabel = "short-break"
+
+// LongBreakLabel is used to get the pomodoro long break period from
+// configuration.
+const LongBreakLabel = "long-break"
+
+// LongBreakEveryLabel is used to get the number of work periods between long
+// breaks from configuration.
+const LongBreakEveryLabel = "long-break-every"
+
+var _ Pattern = (*TimerPattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*TimerPattern)(nil) // ensures we conform to the runnable interface
+
+// String is a customized version of the BasePattern String that also includes
+// information about the current period.
+func (p *TimerPattern) String() string {
+	str := p.BasePattern.String()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.phase != "" {
+		str += fmt.Sprintf(" %s=%s", p.phase, p.remaining.Round(time.Second))
+		if p.paused {
+			str += " paused"
+		}
+	}
+
+	return str
+}
+
+// Pause stops the countdown until resumed.
+func (p *TimerPattern) Pause() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paused = true
+	p.log.Info().Str("phase", p.phase).Dur("remaining", p.remaining).Msg("paused")
+}
+
+// Resume continues a paused countdown.
+func (p *TimerPattern) Resume() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paused = false
+	p.log.Info().Str("phase", p.phase).Dur("remaining", p.remaining).Msg("resumed")
+}
+
+// Skip ends the current period immediately, moving on to the next pomodoro
+// period (if enabled).
+func (p *TimerPattern) Skip() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.skipped = true
+	p.log.Info().Str("phase", p.phase).Dur("remaining", p.remaining).Msg("skipped")
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+const timerPhase = "timer"
+const workPhase = "work"
+
+func init() {
+	register("timer", &TimerPattern{}, 1*time.Second)
+}
+
+func (p *TimerPattern) run() error {
+	pomodoro := config.GetBool(p.Name + "." + PomodoroLabel)
+
+	p.mutex.Lock()
+	p.paused = false
+	p.skipped = false
+	p.worked = 0
+	p.mutex.Unlock()
+
+	p.lastColor = ""
+	p.lastBrightness = ""
+
+	defer func() {
+		p.mutex.Lock()
+		p.phase = ""
+		p.mutex.Unlock()
+	}()
+
+	phase := timerPhase
+	if pomodoro {
+		phase = workPhase
+	}
+
+	for {
+		expired, err := p.countdown(phase)
+		if err != nil || p.ctx.Err() != nil {
+			return err
+		}
+
+		if expired {
+			err = p.flash(phase)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !pomodoro {
+			return nil
+		}
+
+		phase = p.nextPhase(phase)
+	}
+}
+
+func (p *TimerPattern) countdown(phase string) (bool, error) {
+	total, err := p.getPeriod(phase)
+	if err != nil {
+		return false, err
+	}
+
+	from, to, err := p.getColors(phase)
+	if err != nil {
+		return false, err
+	}
+
+	p.mutex.Lock()
+	p.phase = phase
+	p.remaining = total
+	p.skipped = false
+	p.mutex.Unlock()
+
+	p.log.Info().Str("phase", phase).Dur("duration", total).Msg("counting down")
+
+	for {
+		p.mutex.Lock()
+		remaining := p.remaining
+		p.mutex.Unlock()
+
+		progress := 1 - float64(remaining)/float64(total)
+		err = p.show(from, to, progress)
+		if err != nil {
+			return false, err
+		}
+
+		if remaining <= 0 {
+			return true, nil
+		}
+
+		start := time.Now()
+		if p.cancelableSleep() {
+			return false, nil
+		}
+
+		p.mutex.Lock()
+		if p.skipped {
+			p.mutex.Unlock()
+			return false, nil
+		}
+		if !p.paused {
+			p.remaining -= time.Since(start)
+			if p.remaining < 0 {
+				p.remaining = 0
+			}
+		}
+		p.mutex.Unlock()
+	}
+}
+
+func (p *TimerPattern) show(from, to keyboard.RGBColor, progress float64) error {
+	var color, brightness string
+
+	if config.GetBool(p.Name + "." + DimLabel) {
+		color = from.GetColorInHex()
+		brightness = strconv.Itoa(int(math.Round(255 * (1 - progress))))
+	} else {
+		color = from.Blend(to, progress).GetColorInHex()
+		brightness = "255"
+	}
+
+	if color != p.lastColor {
+		err := keyboard.ColorFileHandler(color)
+		if err != nil {
+			return err
+		}
+		p.lastColor = color
+	}
+
+	if brightness != p.lastBrightness {
+		err := keyboard.BrightnessFileHandler(brightness)
+		if err != nil {
+			return err
+		}
+		p.lastBrightness = brightness
+	}
+
+	return nil
+}
+
+func (p *TimerPattern) flash(phase string) error {
+	_, to, err := p.getColors(phase)
+	if err != nil {
+		return err
+	}
+
+	p.log.Info().Str("phase", phase).Msg("expired")
+
+	return notify.Play(p.ctx, &notify.Notification{
+		Color: to.GetColorInHex(),
+		Count: 3,
+		Style: notify.BlinkStyle,
+		Delay: 250 * time.Millisecond,
+	})
+}
+
+func (p *TimerPattern) nextPhase(phase string) string {
+	if phase != workPhase {
+		return workPhase
+	}
+
+	p.mutex.Lock()
+	p.worked++
+	worked := p.worked
+	p.mutex.Unlock()
+
+	every := config.GetInt(p.Name + "." + LongBreakEveryLabel)
+	if every > 0 && worked%every == 0 {
+		return LongBreakLabel
+	}
+
+	return ShortBreakLabel
+}
+
+func (p *TimerPattern) getPeriod(phase string) (time.Duration, error) {
+	label := DurationLabel
+	if phase != timerPhase {
+		label = phase
+	}
+
+	period := config.GetDuration(p.Name + "." + label)
+	if period <= 0 {
+		return 0, fmt.Errorf("%s period must be positive: %s", phase, period)
+	}
+
+	return period, nil
+}
+
+func (p *TimerPattern) getColors(phase string) (keyboard.RGBColor, keyboard.RGBColor, error) {
+	fromLabel, toLabel := FromColorLabel, ToColorLabel
+	if phase == ShortBreakLabel || phase == LongBreakLabel {
+		// breaks lead back into the starting color of the next work period
+		fromLabel, toLabel = BreakColorLabel, FromColorLabel
+	}
+
+	from, err := keyboard.ParseColor(config.GetString(p.Name + "." + fromLabel))
+	if err != nil {
+		return from, from, err
+	}
+
+	to, err := keyboard.ParseColor(config.GetString(p.Name + "." + toLabel))
+	return from, to, err
+}
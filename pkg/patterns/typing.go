@@ -1,18 +1,15 @@
 package patterns
 
 import (
-	"bufio"
-	"bytes"
-	"context"
-	"encoding/binary"
 	"fmt"
-	"os"
-	"regexp"
-	"strings"
+	"math"
+	"os/user"
 	"sync/atomic"
 	"time"
 
+	"github.com/BitPonyLLC/huekeys/pkg/input"
 	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+	"github.com/BitPonyLLC/huekeys/pkg/stats"
 	"github.com/BitPonyLLC/huekeys/pkg/util"
 
 	"github.com/rs/zerolog"
@@ -20,46 +17,91 @@ import (
 
 // TypingPattern is used when changing when changing colors from "cold" (blue) to "hot" (red)
 // according to the speed of key presses occurring. The "delay" configuration value expresses
-// the amount of time to wait between evaluating the number of keys recently pressed.
+// the amount of time to wait between evaluating the number of keys recently pressed while the
+// "gradient" value expresses the colors to use. The "metric" value can instead choose colors
+// according to typing accuracy (how often corrections are made) or a blend of both.
 type TypingPattern struct {
 	BasePattern
 
-	eventfile    *os.File
 	lastReportAt time.Time
 	lastReadAt   time.Time
+	stats        *stats.Typing
+	statsUser    *user.User
+	printables   *stats.Window
+	corrections  *stats.Window
 }
 
-// DefaultIdlePeriod is the amount of time the TypingPattern will wait before
-// declaring idle and, if configured, starting another pattern until keys are
-// pressed again.
-const DefaultIdlePeriod = 30 * time.Second
+// TypingEvent is an event that is emitted when the words per minute typed
+// changes.
+type TypingEvent struct {
+	WPM int
+}
 
 // InputEventIDLabel is used to get the event ID from configuration.
 const InputEventIDLabel = "input-event-id"
 
+// DevicesLabel is used to get the input devices to watch from configuration.
+const DevicesLabel = "devices"
+
 // AllKeysLabel is used to get the all keys value from configuration.
 const AllKeysLabel = "all-keys"
 
-// IdleLabel is used to get the idle pattern from configuration.
-const IdleLabel = "idle"
+// StatsPathLabel is used to get the location to persist daily typing totals
+// from configuration.
+const StatsPathLabel = "stats-path"
+
+// StatsSavePeriod is how often the daily typing totals are persisted.
+const StatsSavePeriod = time.Minute
+
+// MetricLabel is used to get what determines the typing color from
+// configuration.
+const MetricLabel = "metric"
+
+// AccuracyWindowLabel is used to get the amount of recent typing used to
+// measure accuracy from configuration.
+const AccuracyWindowLabel = "accuracy-window"
+
+// MaxErrorRatioLabel is used to get the ratio of corrections to printable key
+// presses that shows the "hottest" color from configuration.
+const MaxErrorRatioLabel = "max-error-ratio"
+
+const (
+	// SpeedMetric chooses colors according to how fast keys are pressed.
+	SpeedMetric = "speed"
+
+	// AccuracyMetric chooses colors according to how often backspace or delete
+	// are pressed compared to printable keys.
+	AccuracyMetric = "accuracy"
+
+	// BlendMetric chooses colors halfway between the speed and accuracy
+	// metrics.
+	BlendMetric = "blend"
+)
+
+// TypingMetrics are the metrics available to choose typing colors.
+var TypingMetrics = []string{SpeedMetric, AccuracyMetric, BlendMetric}
 
-// IdlePeriodLabel is used to get the idle period from configuration.
-const IdlePeriodLabel = "idle-period"
+// DefaultAccuracyWindow is the amount of recent typing used to measure
+// accuracy.
+const DefaultAccuracyWindow = 30 * time.Second
+
+// DefaultMaxErrorRatio is the ratio of corrections to printable key presses
+// that shows the "hottest" color.
+const DefaultMaxErrorRatio = 0.2
 
 var _ Pattern = (*TypingPattern)(nil)  // ensures we conform to the Pattern interface
 var _ runnable = (*TypingPattern)(nil) // ensures we conform to the runnable interface
 
 const traceReportPeriod = 10 * time.Second
 
-// String is a customized version of the BasePattern String that also includes
-// information about the idle settings.
-func (p *TypingPattern) String() string {
-	str := p.BasePattern.String()
-	idlePattern := p.getIdlePattern()
-	if idlePattern != nil {
-		str += fmt.Sprintf(" %s=[%s]", IdleLabel, idlePattern)
-	}
-	return str
+// the number of pending key presses that reaches the hottest color (i.e. the
+// classic gradient's length, which one color step per press was tuned for)
+var speedCounts = len(coldHotColors)
+
+// Stats returns the typing statistics of the current (or most recent) session,
+// or nil if the pattern has never run.
+func (p *TypingPattern) Stats() *stats.Typing {
+	return p.stats
 }
 
 func init() {
@@ -67,259 +109,207 @@ func init() {
 }
 
 func (p *TypingPattern) run() error {
-	inputEventID := config.GetString(p.Name + InputEventIDLabel)
-	if inputEventID == "" {
-		var err error
-		inputEventID, err = lookupInputEventID()
+	p.stats = stats.NewTyping()
+	p.statsUser = nil
+	statsPath := config.GetString(p.Name + "." + StatsPathLabel)
+	if statsPath != "" {
+		statsPath, u, err := expandUserPath(statsPath)
 		if err != nil {
 			return err
 		}
+
+		// only ever read or written with the permissions of the user
+		p.statsUser = u
+		err = util.AsUser(u, func() error { return p.stats.Load(statsPath) })
+		if err != nil {
+			p.log.Warn().Err(err).Msg("can't load typing stats")
+		}
 	}
 
-	eventpath := "/dev/input/" + inputEventID
+	defer p.saveStats()
 
-	keyPressCount := int32(0)
-	err := keyboard.ColorFileHandler(coldHotColors[0])
+	colors, err := p.getGradient()
 	if err != nil {
 		return err
 	}
 
-	go p.setColor(&keyPressCount)
+	metric := config.GetString(p.Name + "." + MetricLabel)
+	switch metric {
+	case "":
+		metric = SpeedMetric
+	case SpeedMetric, AccuracyMetric, BlendMetric:
+	default:
+		return fmt.Errorf("unknown typing metric: %s", metric)
+	}
+
+	accuracyWindow := config.GetDuration(p.Name + "." + AccuracyWindowLabel)
+	if accuracyWindow <= 0 {
+		accuracyWindow = DefaultAccuracyWindow
+	}
 
-	err = p.startTypingProcessor(eventpath, &keyPressCount)
+	p.printables = &stats.Window{Period: accuracyWindow}
+	p.corrections = &stats.Window{Period: accuracyWindow}
+
+	watcher, err := p.watchKeyboards()
 	if err != nil {
 		return err
 	}
 
-	// defer as a closure to make sure we close the most recently set eventfile
-	defer func() {
-		p.eventfile.Close()
-	}()
-
-	wokeWatcher := util.StartWokeWatch(10*time.Second, time.Second, func(diff time.Duration) {
-		p.log.Warn().Dur("diff", diff).Msg("woke detected: reopening input")
-		err := p.startTypingProcessor(eventpath, &keyPressCount)
-		if err != nil {
-			p.log.Err(err).Msg("typing processor failed to reopen input")
-		}
-	})
-	defer wokeWatcher.Stop()
+	keyPressCount := int32(0)
+	err = keyboard.ColorFileHandler(colors[0])
+	if err != nil {
+		return err
+	}
 
-	<-p.ctx.Done()
-	p.stopRequested = true
+	go p.setColor(colors, metric, &keyPressCount)
 
+	p.processTypingEvents(watcher, &keyPressCount)
 	return nil
 }
 
-func (p *TypingPattern) setColor(keyPressCount *int32) {
+func (p *TypingPattern) setColor(colors []string, metric string, keyPressCount *int32) {
 	defer util.LogRecover()
 
-	var idleAt *time.Time
-	var cancelFunc context.CancelFunc
-
 	lastIndex := 0
-	colorsLen := len(coldHotColors)
+	lastReleases := atomic.LoadInt32(&p.releases)
+	lastWPM := 0
+	lastSaveAt := time.Now()
+	colorsLen := len(colors)
 
 	for {
 		if p.cancelableSleep() {
 			break
 		}
 
+		wpm := int(math.Round(p.stats.WPM()))
+		if wpm != lastWPM {
+			lastWPM = wpm
+			Events.Emit(TypingEvent{WPM: wpm})
+		}
+
+		if time.Since(lastSaveAt) > StatsSavePeriod {
+			lastSaveAt = time.Now()
+			p.saveStats()
+		}
+
 		i := int(atomic.LoadInt32(keyPressCount))
-		if i >= colorsLen {
-			i = colorsLen - 1
+		if i >= speedCounts {
+			i = speedCounts - 1
 		}
 
 		if p.log.GetLevel() == zerolog.TraceLevel && time.Since(p.lastReportAt) > traceReportPeriod {
 			p.lastReportAt = time.Now()
-			var idleVal time.Time
-			if idleAt != nil {
-				idleVal = *idleAt
-			}
-			p.log.Trace().Time("idle-at", idleVal).Time("read-at", p.lastReadAt).
+			p.log.Trace().Time("read-at", p.lastReadAt).
 				Int("count", i).Int("last-index", lastIndex).Msg("report")
 		}
 
+		if releases := atomic.LoadInt32(&p.releases); releases != lastReleases {
+			// an idle pattern was running: show the typing color again
+			lastReleases = releases
+			lastIndex = -1
+		}
+
+		// scaled so the number of steps in the gradient doesn't change how fast
+		// one must type to reach the hottest color
+		index := i * (colorsLen - 1) / (speedCounts - 1)
+		switch metric {
+		case AccuracyMetric:
+			index = p.accuracyIndex(colorsLen)
+		case BlendMetric:
+			index = (index + p.accuracyIndex(colorsLen)) / 2
+		}
+
 		// don't bother setting the same value and wait for 2 keypresses to
 		// avoid halting the pattern for control-key sequences
-		if i > 1 && i != lastIndex {
-			color := coldHotColors[i]
+		if i > 1 && index != lastIndex {
+			color := colors[index]
 			err := keyboard.ColorFileHandler(color)
 			if err != nil {
 				p.log.Err(err).Msg("can't set typing color")
 				break
 			}
 
-			lastIndex = i
+			lastIndex = index
 		}
 
-		if i > 0 {
-			if i > 1 {
-				idleAt = nil
-				if cancelFunc != nil {
-					cancelFunc()
-					cancelFunc = nil
-					p.log.Debug().Msg("no longer idle")
-				}
-			}
-
-			if atomic.LoadInt32(keyPressCount) > 0 {
-				atomic.AddInt32(keyPressCount, -1)
-			}
-
-			continue
-		}
-
-		if idleAt == nil {
-			now := time.Now()
-			idleAt = &now
-			continue
-		}
-
-		if cancelFunc != nil {
-			// don't start another background monitor!
-			continue
-		}
-
-		idlePattern := p.getIdlePattern()
-		if idlePattern == nil {
-			continue
-		}
-
-		diff := time.Since(*idleAt)
-		if diff > p.getIdlePeriod() {
-			p.log.Debug().Msg("idle")
-			var cancelCtx context.Context
-			cancelCtx, cancelFunc = context.WithCancel(p.ctx)
-			go func() {
-				defer util.LogRecover()
-				// using the private runner otherwise, we'll get canceled! ;)
-				err := idlePattern.GetBase().rawRun(cancelCtx, p.log, "idle")
-				if err != nil {
-					p.log.Err(err).Str("idle", idlePattern.String()).Msg("pattern failed")
-				}
-			}()
+		if atomic.LoadInt32(keyPressCount) > 0 {
+			atomic.AddInt32(keyPressCount, -1)
 		}
 	}
-
-	if cancelFunc != nil {
-		cancelFunc()
-	}
-}
-
-func (p *TypingPattern) startTypingProcessor(eventpath string, keyPressCount *int32) error {
-	if p.eventfile != nil {
-		p.eventfile.Close()
-	}
-
-	var err error
-	p.eventfile, err = os.Open(eventpath)
-	if err != nil {
-		return fmt.Errorf("can't open input events device (%s): %w", eventpath, err)
-	}
-
-	go p.processTypingEvents(keyPressCount)
-	return nil
 }
 
-func (p *TypingPattern) processTypingEvents(keyPressCount *int32) {
-	defer util.LogRecover()
-
-	// https://janczer.github.io/work-with-dev-input/
-	buf := make([]byte, 24)
-	for !p.stopRequested {
-		_, err := p.eventfile.Read(buf)
-		if err != nil {
-			p.log.Err(err).Msg("can't read input events device")
+func (p *TypingPattern) processTypingEvents(watcher *input.Watcher, keyPressCount *int32) {
+	for {
+		var ev input.Event
+		select {
+		case <-p.ctx.Done():
+			p.stopRequested = true
 			return
+		case ev = <-watcher.Events:
 		}
 
-		if p.log.GetLevel() == zerolog.TraceLevel {
-			sec := binary.LittleEndian.Uint64(buf[0:8])
-			usec := binary.LittleEndian.Uint64(buf[8:16])
-			p.lastReadAt = time.Unix(int64(sec), int64(usec)*1000)
-		}
+		p.lastReadAt = ev.Time
 
-		// typ is the kind of event being reported
-		typ := binary.LittleEndian.Uint16(buf[16:18])
+		// we only care when a key is pressed
+		if ev.IsKeyPress() {
+			printable := input.IsPrintable(ev.Code)
+			p.stats.Record(ev.Time, printable)
 
-		// value is the state of the event being reported (on/off, pressed/unpressed, etc.)
-		var value int32
-		binary.Read(bytes.NewReader(buf[20:]), binary.LittleEndian, &value)
+			if printable {
+				p.printables.Add(ev.Time)
+			} else if input.IsCorrection(ev.Code) {
+				p.corrections.Add(ev.Time)
+			}
 
-		// we only care when typ is EV_KEY and value indicates "pressed"
-		// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L34-L51
-		if typ == 1 && value == 1 {
-			// in this context, code indicates what key was pressed
-			code := binary.LittleEndian.Uint16(buf[18:20])
-			if p.countAllKeys() || isPrintable(code) {
+			if p.countAllKeys() || printable {
 				atomic.AddInt32(keyPressCount, 1)
 			}
 		}
 	}
 }
 
-func (p *TypingPattern) countAllKeys() bool {
-	return config.GetBool(p.Name + "." + AllKeysLabel)
-}
-
-func (p *TypingPattern) getIdlePattern() Pattern {
-	name := config.GetString(p.Name + "." + IdleLabel)
-	if name == "" {
-		return nil
+// accuracyIndex maps the recent ratio of corrections to printable key presses
+// onto the gradient (i.e. more corrections are "hotter").
+func (p *TypingPattern) accuracyIndex(colorsLen int) int {
+	printables := p.printables.Count()
+	if printables == 0 {
+		return 0
 	}
 
-	idlePattern := Get(name)
-	if idlePattern == nil {
-		p.log.Error().Str("idle", name).Msg("pattern not found")
-		return nil
+	maxRatio := config.GetFloat64(p.Name + "." + MaxErrorRatioLabel)
+	if maxRatio <= 0 {
+		maxRatio = DefaultMaxErrorRatio
 	}
 
-	return idlePattern
+	ratio := float64(p.corrections.Count()) / float64(printables)
+	return int(clamp(ratio/maxRatio, 0, 1) * float64(colorsLen-1))
 }
 
-func (p *TypingPattern) getIdlePeriod() time.Duration {
-	return config.GetDuration(p.Name + "." + IdlePeriodLabel)
-}
-
-var keyboardEventRE = regexp.MustCompile(`[= ](event\d+)( |$)`)
+func (p *TypingPattern) saveStats() {
+	if p.statsUser == nil {
+		return
+	}
 
-func lookupInputEventID() (string, error) {
-	f, err := os.Open("/proc/bus/input/devices")
+	err := util.AsUser(p.statsUser, p.stats.Save)
 	if err != nil {
-		return "", fmt.Errorf("can't open input devices list: %w", err)
+		p.log.Err(err).Msg("can't save typing stats")
 	}
-	defer f.Close()
+}
 
-	found := false
+// watchKeyboards will begin reading key presses from all keyboards selected by
+// the typing configuration (shared by all patterns that react to key presses).
+func (p *BasePattern) watchKeyboards() (*input.Watcher, error) {
+	specs := config.GetStringSlice("typing." + DevicesLabel)
+	specs = append(specs, config.GetString("typing."+InputEventIDLabel))
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-		switch line[0] {
-		case 'N':
-			found = strings.Contains(strings.ToLower(line), "keyboard")
-		case 'H':
-			if found {
-				match := keyboardEventRE.FindStringSubmatch(line)
-				if match != nil {
-					return match[1], nil
-				}
-			}
-		}
+	selects, err := input.NewSelector(specs...)
+	if err != nil {
+		return nil, err
 	}
 
-	return "", fmt.Errorf("can't find a keyboard input device")
+	return input.Watch(p.ctx, p.log, selects)
 }
 
-func isPrintable(code uint16) bool {
-	// https://github.com/torvalds/linux/blob/v5.17/include/uapi/linux/input-event-codes.h#L64
-	return (1 < code && code < 14) ||
-		(15 < code && code < 29) ||
-		(29 < code && code < 42) ||
-		(42 < code && code < 54) ||
-		(code == 57)
+func (p *TypingPattern) countAllKeys() bool {
+	return config.GetBool(p.Name + "." + AllKeysLabel)
 }
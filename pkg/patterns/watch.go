@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"syscall"
 
 	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
@@ -12,7 +13,8 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// WatchPattern will report every color, brightness, and pattern change to the Out writer.
+// WatchPattern will report every color, brightness, pattern, idle pattern, and
+// typing speed change to the Out writer.
 type WatchPattern struct {
 	BasePattern
 
@@ -44,14 +46,17 @@ func (p *WatchPattern) Run(parent context.Context, _ *zerolog.Logger) error {
 		break // all will be set to the same value
 	}
 
-	var running string
+	var running, idle string
 	pattern := GetRunning()
 	if pattern != nil {
 		running = pattern.GetBase().Name
+		if idlePattern := pattern.GetBase().IdlePattern(); idlePattern != nil {
+			idle = idlePattern.GetBase().Name
+		}
 	}
 
 	// always produce a report immediately
-	err = p.report(brightness, color, running)
+	err = p.report(brightness, color, running, idle, "")
 	if err != nil {
 		return err
 	}
@@ -68,6 +73,8 @@ func (p *WatchPattern) Run(parent context.Context, _ *zerolog.Logger) error {
 		brightness = ""
 		color = ""
 		running = ""
+		idle = ""
+		wpm := ""
 
 		select {
 		case <-parent.Done():
@@ -77,11 +84,20 @@ func (p *WatchPattern) Run(parent context.Context, _ *zerolog.Logger) error {
 			change := ev.(keyboard.ChangeEvent)
 			brightness = change.Brightness
 			color = change.Color
+			if change.Zone != "" && color != "" {
+				color = change.Zone + "=" + color
+			}
 		case ev := <-patternWatcher.Ch:
-			running = ev.(ChangeEvent).Pattern
+			switch change := ev.(type) {
+			case ChangeEvent:
+				running = change.Pattern
+				idle = change.Idle
+			case TypingEvent:
+				wpm = strconv.Itoa(change.WPM)
+			}
 		}
 
-		err = p.report(brightness, color, running)
+		err = p.report(brightness, color, running, idle, wpm)
 		if err != nil {
 			if errors.Is(err, syscall.EPIPE) {
 				// client is gone: close up shop!
@@ -93,7 +109,7 @@ func (p *WatchPattern) Run(parent context.Context, _ *zerolog.Logger) error {
 	}
 }
 
-func (p *WatchPattern) report(brightness, color, running string) error {
+func (p *WatchPattern) report(brightness, color, running, idle, wpm string) error {
 	msg := ""
 
 	if brightness != "" {
@@ -108,6 +124,14 @@ func (p *WatchPattern) report(brightness, color, running string) error {
 		msg += "r:" + running + "\n"
 	}
 
+	if idle != "" {
+		msg += "i:" + idle + "\n"
+	}
+
+	if wpm != "" {
+		msg += "w:" + wpm + "\n"
+	}
+
 	if msg != "" {
 		_, err := p.Out.Write([]byte(msg))
 		if err != nil {
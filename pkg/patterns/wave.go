@@ -0,0 +1,258 @@
+package patterns
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BitPonyLLC/huekeys/pkg/keyboard"
+)
+
+// WavePattern is used when smoothly changing the brightness, hue, or saturation
+// of the keyboard according to a repeating waveform (e.g. a natural looking
+// "breathing" effect). The "delay" configuration value expresses the amount of
+// time to wait between updates while the "period" value expresses how long one
+// full cycle of the waveform takes, regardless of the number of updates.
+type WavePattern struct {
+	BasePattern
+}
+
+// ShapeLabel is used to get the waveform shape from configuration.
+const ShapeLabel = "shape"
+
+// PeriodLabel is used to get the length of one waveform cycle from
+// configuration.
+const PeriodLabel = "period"
+
+// MinLabel is used to get the lowest level of the waveform from configuration.
+const MinLabel = "min"
+
+// MaxLabel is used to get the highest level of the waveform from configuration.
+const MaxLabel = "max"
+
+// TargetLabel is used to get what the waveform changes from configuration.
+const TargetLabel = "target"
+
+const (
+	// BrightnessTarget modulates the keyboard brightness.
+	BrightnessTarget = "brightness"
+
+	// HueTarget modulates the hue of the configured color.
+	HueTarget = "hue"
+
+	// SaturationTarget modulates the saturation of the configured color.
+	SaturationTarget = "saturation"
+)
+
+// WaveShapes are the names of the waveform shapes available. Custom easing
+// curves may also be provided as "cubic-bezier(x1, y1, x2, y2)".
+var WaveShapes = []string{"sine", "triangle", "square", "sawtooth", "ease", "ease-in", "ease-out", "ease-in-out"}
+
+var _ Pattern = (*WavePattern)(nil)  // ensures we conform to the Pattern interface
+var _ runnable = (*WavePattern)(nil) // ensures we conform to the runnable interface
+
+// String is a customized version of the BasePattern String that also includes
+// the waveform settings.
+func (p *WavePattern) String() string {
+	return fmt.Sprintf("%s %s=%s %s=%s %s=%s", p.BasePattern.String(),
+		ShapeLabel, config.GetString(p.Name+"."+ShapeLabel),
+		PeriodLabel, config.GetDuration(p.Name+"."+PeriodLabel),
+		TargetLabel, config.GetString(p.Name+"."+TargetLabel))
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// cubic-bezier control points for the CSS standard easing names
+var easings = map[string][4]float64{
+	"ease":        {0.25, 0.1, 0.25, 1},
+	"ease-in":     {0.42, 0, 1, 1},
+	"ease-out":    {0, 0, 0.58, 1},
+	"ease-in-out": {0.42, 0, 0.58, 1},
+}
+
+func init() {
+	register("wave", &WavePattern{}, 20*time.Millisecond)
+}
+
+func (p *WavePattern) run() error {
+	wave, err := parseWaveShape(config.GetString(p.Name + "." + ShapeLabel))
+	if err != nil {
+		return err
+	}
+
+	period := config.GetDuration(p.Name + "." + PeriodLabel)
+	if period <= 0 {
+		return fmt.Errorf("%s must be positive: %s", PeriodLabel, period)
+	}
+
+	min := clamp(config.GetFloat64(p.Name+"."+MinLabel), 0, 1)
+	max := clamp(config.GetFloat64(p.Name+"."+MaxLabel), 0, 1)
+
+	set, err := p.getSetter()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	for {
+		phase := math.Mod(float64(time.Since(start))/float64(period), 1)
+		level := min + (max-min)*wave(phase)
+
+		err = set(level)
+		if err != nil {
+			return err
+		}
+
+		if p.cancelableSleep() {
+			return nil
+		}
+	}
+}
+
+// getSetter returns a function that applies a level (0.0 to 1.0) to the
+// configured target, only writing when the resulting value changes
+func (p *WavePattern) getSetter() (func(float64) error, error) {
+	target := config.GetString(p.Name + "." + TargetLabel)
+
+	if target == BrightnessTarget {
+		last := ""
+		return func(level float64) error {
+			brightness := strconv.Itoa(int(math.Round(255 * level)))
+			if brightness == last {
+				return nil
+			}
+			last = brightness
+			return keyboard.BrightnessFileHandler(brightness)
+		}, nil
+	}
+
+	color, err := keyboard.ParseColor(config.GetString(p.Name + "." + ColorLabel))
+	if err != nil {
+		return nil, err
+	}
+
+	h, s, v := color.HSV()
+
+	var toColor func(float64) keyboard.RGBColor
+	switch target {
+	case HueTarget:
+		toColor = func(level float64) keyboard.RGBColor { return keyboard.FromHSV(360*level, s, v) }
+	case SaturationTarget:
+		toColor = func(level float64) keyboard.RGBColor { return keyboard.FromHSV(h, level, v) }
+	default:
+		return nil, fmt.Errorf("unknown %s %s: %s", p.Name, TargetLabel, target)
+	}
+
+	last := ""
+	return func(level float64) error {
+		hex := toColor(level).GetColorInHex()
+		if hex == last {
+			return nil
+		}
+		last = hex
+		return keyboard.ColorFileHandler(hex)
+	}, nil
+}
+
+// parseWaveShape returns a function that maps a phase (0.0 to 1.0) of one cycle
+// into a level (0.0 to 1.0)
+func parseWaveShape(shape string) (func(float64) float64, error) {
+	switch shape {
+	case "sine":
+		return func(phase float64) float64 { return 0.5 - 0.5*math.Cos(2*math.Pi*phase) }, nil
+	case "triangle":
+		return triangle, nil
+	case "square":
+		return func(phase float64) float64 {
+			if phase < 0.5 {
+				return 1
+			}
+			return 0
+		}, nil
+	case "sawtooth":
+		return func(phase float64) float64 { return phase }, nil
+	}
+
+	points, ok := easings[shape]
+	if !ok {
+		var err error
+		points, err = parseCubicBezier(shape)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// easing curves rise over the first half of the cycle and mirror on the way
+	// back down (y values outside of 0 to 1 overshoot, so are held at the limits)
+	return func(phase float64) float64 {
+		return clamp(cubicBezier(points, triangle(phase)), 0, 1)
+	}, nil
+}
+
+func parseCubicBezier(shape string) ([4]float64, error) {
+	var points [4]float64
+
+	if !strings.HasPrefix(shape, "cubic-bezier(") || !strings.HasSuffix(shape, ")") {
+		return points, fmt.Errorf("unknown wave shape: %s (expected one of %s or cubic-bezier(x1, y1, x2, y2))",
+			shape, strings.Join(WaveShapes, ", "))
+	}
+
+	args := strings.TrimSuffix(strings.TrimPrefix(shape, "cubic-bezier("), ")")
+	parts := strings.Split(args, ",")
+	if len(parts) != 4 {
+		return points, fmt.Errorf("cubic-bezier requires four values: %s", shape)
+	}
+
+	for i, part := range parts {
+		val, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return points, fmt.Errorf("can't parse cubic-bezier value (%s): %w", part, err)
+		}
+		points[i] = val
+	}
+
+	if points[0] < 0 || points[0] > 1 || points[2] < 0 || points[2] > 1 {
+		return points, fmt.Errorf("cubic-bezier x values must be between 0 and 1: %s", shape)
+	}
+
+	return points, nil
+}
+
+func triangle(phase float64) float64 {
+	if phase < 0.5 {
+		return 2 * phase
+	}
+	return 2 - 2*phase
+}
+
+// cubicBezier evaluates a CSS-style easing curve (from 0,0 to 1,1 with the
+// provided control points) finding the y value for the given x
+func cubicBezier(points [4]float64, x float64) float64 {
+	x1, y1, x2, y2 := points[0], points[1], points[2], points[3]
+
+	bezier := func(t, p1, p2 float64) float64 {
+		u := 1 - t
+		return 3*u*u*t*p1 + 3*u*t*t*p2 + t*t*t
+	}
+
+	// x is monotonic in t for valid control points, so bisection always converges
+	lo, hi := 0.0, 1.0
+	t := x
+	for i := 0; i < 32; i++ {
+		t = (lo + hi) / 2
+		if bezier(t, x1, x2) < x {
+			lo = t
+		} else {
+			hi = t
+		}
+	}
+
+	return bezier(t, y1, y2)
+}
+
+func clamp(val, min, max float64) float64 {
+	return math.Max(min, math.Min(max, val))
+}
@@ -0,0 +1,479 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition is a parsed boolean expression that can be evaluated against the
+// values provided by an Env.
+type Condition interface {
+	Eval(Env) (bool, error)
+	String() string
+}
+
+// Env provides the values for names referenced in expressions. The arg is only
+// set for function-style references (e.g. `file("/path")`).
+type Env interface {
+	Value(name, arg string) (float64, error)
+}
+
+// Parse compiles an expression like `temp > 85 or load1 > nproc * 0.75` into a
+// Condition. Comparisons (>, >=, <, <=, ==, !=) may be combined with `and`,
+// `or`, `not`, and parentheses. Operands are numbers, source names, or source
+// functions and support simple arithmetic (+, -, *, /).
+func Parse(expr string) (Condition, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %q: %w", expr, err)
+	}
+
+	if !p.done() {
+		return nil, fmt.Errorf("can't parse %q: unexpected %q", expr, p.peek().text)
+	}
+
+	return cond, nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+type tokenKind int
+
+const (
+	numberToken tokenKind = iota
+	identToken
+	stringToken
+	symbolToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var symbols = []string{">=", "<=", "==", "!=", "&&", "||", ">", "<", "!", "(", ")", "+", "-", "*", "/"}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{numberToken, string(runes[start:i])})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{identToken, string(runes[start:i])})
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in %q", expr)
+			}
+			tokens = append(tokens, token{stringToken, string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			found := false
+			for _, sym := range symbols {
+				if strings.HasPrefix(string(runes[i:]), sym) {
+					tokens = append(tokens, token{symbolToken, sym})
+					i += len([]rune(sym))
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected %q in %q", r, expr)
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) accept(texts ...string) (string, bool) {
+	if p.done() {
+		return "", false
+	}
+	tok := p.tokens[p.pos]
+	if tok.kind != symbolToken && tok.kind != identToken {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) parseOr() (Condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("or", "||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "or", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (Condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("and", "&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "and", left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (Condition, error) {
+	if _, ok := p.accept("not", "!"); ok {
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{cond: cond}, nil
+	}
+
+	if _, ok := p.accept("true"); ok {
+		return constant(true), nil
+	}
+
+	if _, ok := p.accept("false"); ok {
+		return constant(false), nil
+	}
+
+	if p.peek().kind == symbolToken && p.peek().text == "(" {
+		// could be a grouped condition or a grouped operand: try the condition first
+		start := p.pos
+		p.pos++
+		cond, err := p.parseOr()
+		if err == nil {
+			if _, ok := p.accept(")"); ok {
+				return cond, nil
+			}
+		}
+		p.pos = start
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Condition, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := p.accept(">", ">=", "<", "<=", "==", "!=")
+	if !ok {
+		return nil, fmt.Errorf("expected a comparison after %s", left)
+	}
+
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	return &comparison{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseSum() (operand, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseProduct() (operand, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	if _, ok := p.accept("("); ok {
+		val, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return val, nil
+	}
+
+	if _, ok := p.accept("-"); ok {
+		val, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &arithmetic{op: "-", left: number(0), right: val}, nil
+	}
+
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch tok.kind {
+	case numberToken:
+		val, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse number %q: %w", tok.text, err)
+		}
+		return number(val), nil
+	case identToken:
+		ref := &reference{name: tok.text}
+		if _, ok := p.accept("("); ok {
+			if p.done() || p.tokens[p.pos].kind != stringToken {
+				return nil, fmt.Errorf("expected a quoted argument for %s", tok.text)
+			}
+			ref.arg = p.tokens[p.pos].text
+			p.pos++
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("missing closing parenthesis for %s", tok.text)
+			}
+		}
+		return ref, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", tok.text)
+}
+
+//--------------------------------------------------------------------------------
+// conditions
+
+type constant bool
+
+func (c constant) Eval(Env) (bool, error) { return bool(c), nil }
+func (c constant) String() string         { return strconv.FormatBool(bool(c)) }
+
+type negation struct {
+	cond Condition
+}
+
+func (n *negation) Eval(env Env) (bool, error) {
+	val, err := n.cond.Eval(env)
+	return !val, err
+}
+
+func (n *negation) String() string {
+	return "not " + n.cond.String()
+}
+
+type logical struct {
+	op    string
+	left  Condition
+	right Condition
+}
+
+func (l *logical) Eval(env Env) (bool, error) {
+	left, err := l.left.Eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	// short-circuit to avoid sampling sources that aren't needed
+	if l.op == "and" && !left {
+		return false, nil
+	}
+	if l.op == "or" && left {
+		return true, nil
+	}
+
+	return l.right.Eval(env)
+}
+
+func (l *logical) String() string {
+	return fmt.Sprintf("(%s %s %s)", l.left, l.op, l.right)
+}
+
+type comparison struct {
+	op    string
+	left  operand
+	right operand
+}
+
+func (c *comparison) Eval(env Env) (bool, error) {
+	left, err := c.left.value(env)
+	if err != nil {
+		return false, err
+	}
+
+	right, err := c.right.value(env)
+	if err != nil {
+		return false, err
+	}
+
+	switch c.op {
+	case ">":
+		return left > right, nil
+	case ">=":
+		return left >= right, nil
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	return false, fmt.Errorf("unknown comparison: %s", c.op)
+}
+
+func (c *comparison) String() string {
+	return fmt.Sprintf("%s %s %s", c.left, c.op, c.right)
+}
+
+//--------------------------------------------------------------------------------
+// operands
+
+type operand interface {
+	value(Env) (float64, error)
+	String() string
+}
+
+type number float64
+
+func (n number) value(Env) (float64, error) { return float64(n), nil }
+func (n number) String() string             { return strconv.FormatFloat(float64(n), 'f', -1, 64) }
+
+type reference struct {
+	name string
+	arg  string
+}
+
+func (r *reference) value(env Env) (float64, error) {
+	return env.Value(r.name, r.arg)
+}
+
+func (r *reference) String() string {
+	if r.arg == "" {
+		return r.name
+	}
+	return fmt.Sprintf("%s(%q)", r.name, r.arg)
+}
+
+type arithmetic struct {
+	op    string
+	left  operand
+	right operand
+}
+
+func (a *arithmetic) value(env Env) (float64, error) {
+	left, err := a.left.value(env)
+	if err != nil {
+		return 0, err
+	}
+
+	right, err := a.right.value(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch a.op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero in %s", a)
+		}
+		return left / right, nil
+	}
+
+	return 0, fmt.Errorf("unknown operator: %s", a.op)
+}
+
+func (a *arithmetic) String() string {
+	return fmt.Sprintf("(%s %s %s)", a.left, a.op, a.right)
+}
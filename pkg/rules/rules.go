@@ -0,0 +1,89 @@
+// Package rules provides a small evaluation engine for choosing actions based
+// on conditions over system metrics (e.g. `temp > 85` or `load1 > nproc`).
+package rules
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Rule pairs a condition with the actions to take when it is the highest
+// priority rule that matches. A rule without a condition always matches and is
+// useful as a final fallback (i.e. an "else").
+type Rule struct {
+	Name     string
+	When     string
+	Priority int
+
+	Color      string
+	Brightness string
+	Flash      string
+	Pattern    string
+
+	cond Condition
+}
+
+// Compile parses the rule's condition and verifies at least one action is
+// provided.
+func (r *Rule) Compile() error {
+	if r.Color == "" && r.Brightness == "" && r.Flash == "" && r.Pattern == "" {
+		return fmt.Errorf("rule %s has no action (color, brightness, flash, or pattern)", r)
+	}
+
+	if r.When == "" {
+		r.cond = constant(true)
+		return nil
+	}
+
+	var err error
+	r.cond, err = Parse(r.When)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", r, err)
+	}
+
+	return nil
+}
+
+// String returns the rule's name or, if unnamed, its condition.
+func (r *Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	if r.When != "" {
+		return r.When
+	}
+	return "else"
+}
+
+// Rules is an ordered set of compiled rules.
+type Rules []*Rule
+
+// Sort orders the rules by priority (highest first) while preserving the
+// configured order of rules with equal priority.
+func (rs Rules) Sort() {
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].Priority > rs[j].Priority
+	})
+}
+
+// Match returns the first rule whose condition is true or nil if none match.
+// Rules that fail to evaluate (e.g. a missing sensor) are skipped and the first
+// such failure is returned along with any match found.
+func (rs Rules) Match(env Env) (*Rule, error) {
+	var firstErr error
+
+	for _, r := range rs {
+		ok, err := r.cond.Eval(env)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("rule %s: %w", r, err)
+			}
+			continue
+		}
+		if ok {
+			return r, firstErr
+		}
+	}
+
+	return nil, firstErr
+}
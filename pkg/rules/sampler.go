@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/BitPonyLLC/huekeys/pkg/metrics"
+)
+
+// Sampler is an Env that reads system metrics, caching each value until Next is
+// called so that a single evaluation sees a consistent snapshot.
+//
+// Built-in names are: cpu, memory, battery (percentages), load1, load5, load15,
+// temp (degrees Celsius), and nproc. The functions file("/path") and
+// command("cmd") read the first number found in a file or in a command's
+// output. Custom names may be provided as "file:/path" or "command:cmd".
+type Sampler struct {
+	ctx     context.Context // stops any command being run when canceled
+	custom  map[string]string
+	cache   map[string]float64
+	lastCPU *metrics.CPUStats
+}
+
+var _ Env = (*Sampler)(nil) // ensures we conform to the Env interface
+
+// NewSampler creates a Sampler with optional custom sources.
+func NewSampler(ctx context.Context, custom map[string]string) *Sampler {
+	return &Sampler{ctx: ctx, custom: custom, cache: map[string]float64{}}
+}
+
+// Next clears all cached values so they are read again when next requested.
+func (s *Sampler) Next() {
+	s.cache = map[string]float64{}
+}
+
+// Value returns the current value of a named source.
+func (s *Sampler) Value(name, arg string) (float64, error) {
+	key := name + ":" + arg
+	if val, ok := s.cache[key]; ok {
+		return val, nil
+	}
+
+	val, err := s.read(name, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	s.cache[key] = val
+	return val, nil
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+func (s *Sampler) read(name, arg string) (float64, error) {
+	if src, ok := s.custom[name]; ok && arg == "" {
+		kind, val, found := strings.Cut(src, ":")
+		if !found {
+			return 0, fmt.Errorf("source %s must be \"file:<path>\" or \"command:<cmd>\"", name)
+		}
+		return s.read(kind, val)
+	}
+
+	switch name {
+	case "cpu":
+		return s.readCPU()
+	case "memory":
+		return metrics.MemoryUsage()
+	case "load1", "load5", "load15":
+		loads, err := metrics.LoadAverage()
+		if err != nil {
+			return 0, err
+		}
+		return loads[map[string]int{"load1": 0, "load5": 1, "load15": 2}[name]], nil
+	case "temp":
+		return metrics.Temperature()
+	case "battery":
+		return metrics.Battery()
+	case "nproc":
+		return metrics.NumCPU(), nil
+	case "file":
+		return metrics.ReadFileValue(arg)
+	case "command":
+		return metrics.CommandValue(s.ctx, arg)
+	}
+
+	return 0, fmt.Errorf("unknown source: %s", name)
+}
+
+func (s *Sampler) readCPU() (float64, error) {
+	current, err := metrics.GetCPUStats()
+	if err != nil {
+		return 0, err
+	}
+
+	previous := s.lastCPU
+	s.lastCPU = current
+
+	if previous == nil {
+		// no window to measure yet
+		return 0, nil
+	}
+
+	return 100 * current.UtilizationSince(previous), nil
+}
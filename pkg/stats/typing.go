@@ -0,0 +1,233 @@
+// Package stats provides tracking and reporting of usage statistics.
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Typing tracks statistics about key presses for a session, optionally
+// persisting daily totals across sessions.
+type Typing struct {
+	StartedAt time.Time
+
+	mutex  sync.Mutex
+	keys   int     // all key presses
+	chars  int     // printable key presses
+	hourly [24]int // printable key presses by hour of the day
+	recent *Window
+	daily  map[string]*DailyTotal
+	path   string
+}
+
+// DailyTotal is the number of key presses recorded on a single day.
+type DailyTotal struct {
+	Keys  int `json:"keys"`
+	Chars int `json:"chars"`
+}
+
+// WPMWindow is the amount of recent time used to calculate the current words
+// per minute.
+const WPMWindow = 30 * time.Second
+
+// CharsPerWord is the standard number of characters counted as a "word" when
+// calculating words per minute.
+const CharsPerWord = 5
+
+// DateFormat is used for the keys of the persisted daily totals.
+const DateFormat = "2006-01-02"
+
+// NewTyping returns an empty Typing tracker for a session starting now.
+func NewTyping() *Typing {
+	return &Typing{
+		StartedAt: time.Now(),
+		recent:    &Window{Period: WPMWindow},
+		daily:     map[string]*DailyTotal{},
+	}
+}
+
+// Record will count a key press that occurred at the provided time.
+func (t *Typing) Record(at time.Time, printable bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	day := t.daily[at.Format(DateFormat)]
+	if day == nil {
+		day = &DailyTotal{}
+		t.daily[at.Format(DateFormat)] = day
+	}
+
+	t.keys++
+	day.Keys++
+
+	if !printable {
+		return
+	}
+
+	t.chars++
+	day.Chars++
+	t.hourly[at.Hour()]++
+	t.recent.Add(at)
+}
+
+// WPM returns the current words per minute, based on printable key presses in
+// the most recent WPMWindow.
+func (t *Typing) WPM() float64 {
+	return wordsPerMinute(t.recent.Count(), WPMWindow)
+}
+
+// AverageWPM returns the words per minute over the entire session.
+func (t *Typing) AverageWPM() float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return wordsPerMinute(t.chars, time.Since(t.StartedAt))
+}
+
+// Load will read the daily totals persisted at path (if any) and will save them
+// back to the same path when Save is called.
+func (t *Typing) Load(path string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("can't read typing stats: %w", err)
+	}
+
+	daily := map[string]*DailyTotal{}
+	err = json.Unmarshal(data, &daily)
+	if err != nil {
+		return fmt.Errorf("can't parse typing stats (%s): %w", path, err)
+	}
+
+	// keep anything recorded before loading
+	for date, day := range t.daily {
+		if loaded := daily[date]; loaded != nil {
+			loaded.Keys += day.Keys
+			loaded.Chars += day.Chars
+		} else {
+			daily[date] = day
+		}
+	}
+
+	t.daily = daily
+	return nil
+}
+
+// Save will persist the daily totals to the path provided to Load. Nothing is
+// saved if Load was never called.
+func (t *Typing) Save() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(t.daily, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(t.path), 0755)
+	if err != nil {
+		return fmt.Errorf("can't create typing stats directory: %w", err)
+	}
+
+	// write to a temporary file first so a crash never leaves a partial file
+	tmp := t.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return fmt.Errorf("can't write typing stats: %w", err)
+	}
+
+	err = os.Rename(tmp, t.path)
+	if err != nil {
+		return fmt.Errorf("can't write typing stats: %w", err)
+	}
+
+	return nil
+}
+
+// Path returns the location where daily totals are persisted (if any).
+func (t *Typing) Path() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.path
+}
+
+// String returns a readable report of the statistics.
+func (t *Typing) String() string {
+	wpm := t.WPM()
+	avg := t.AverageWPM()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "session started = %s (%s ago)\n", t.StartedAt.Format(time.RFC3339), time.Since(t.StartedAt).Round(time.Second))
+	fmt.Fprintf(b, "current wpm = %.0f\n", wpm)
+	fmt.Fprintf(b, "average wpm = %.0f\n", avg)
+	fmt.Fprintf(b, "keys = %d\n", t.keys)
+	fmt.Fprintf(b, "printable = %d\n", t.chars)
+	fmt.Fprintf(b, "words = %d\n", t.chars/CharsPerWord)
+
+	max := 0
+	for _, count := range t.hourly {
+		if count > max {
+			max = count
+		}
+	}
+
+	if max > 0 {
+		b.WriteString("hourly:\n")
+		for hour, count := range t.hourly {
+			if count == 0 {
+				continue
+			}
+			bar := strings.Repeat("#", int(math.Ceil(float64(count)/float64(max)*40)))
+			fmt.Fprintf(b, "  %02d:00 %6d %s\n", hour, count, bar)
+		}
+	}
+
+	if len(t.daily) > 0 {
+		dates := make([]string, 0, len(t.daily))
+		for date := range t.daily {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+
+		b.WriteString("daily:\n")
+		for _, date := range dates {
+			day := t.daily[date]
+			fmt.Fprintf(b, "  %s %8d keys %8d words\n", date, day.Keys, day.Chars/CharsPerWord)
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+func wordsPerMinute(chars int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(chars) / CharsPerWord / elapsed.Minutes()
+}
@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// Window counts events that occurred within a sliding period of time.
+type Window struct {
+	Period time.Duration
+
+	mutex sync.Mutex
+	times []time.Time
+}
+
+// Add will record an event that occurred at the provided time.
+func (w *Window) Add(at time.Time) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.times = append(w.prune(at), at)
+}
+
+// Count returns the number of events that occurred within the period before
+// now.
+func (w *Window) Count() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.times = w.prune(time.Now())
+	return len(w.times)
+}
+
+//--------------------------------------------------------------------------------
+// private
+
+// prune expects the mutex to be held
+func (w *Window) prune(now time.Time) []time.Time {
+	cutoff := now.Add(-w.Period)
+
+	i := 0
+	for i < len(w.times) && w.times[i].Before(cutoff) {
+		i++
+	}
+
+	return w.times[i:]
+}
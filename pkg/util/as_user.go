@@ -0,0 +1,89 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"syscall"
+)
+
+// UserPath is the search path given to commands run as a user.
+const UserPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// RunAs prepares a command to run as the provided user: with the user's
+// credentials when running as root, from their home directory, and with a
+// minimal environment of their own (rather than root's) followed by any extra
+// variables provided.
+func RunAs(cmd *exec.Cmd, u *user.User, extra ...string) error {
+	if os.Getuid() == 0 && u.Uid != "0" {
+		cred, err := CredentialOf(u)
+		if err != nil {
+			return err
+		}
+
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+
+	cmd.Dir = u.HomeDir
+	cmd.Env = []string{"HOME=" + u.HomeDir, "USER=" + u.Username, "LOGNAME=" + u.Username, "PATH=" + UserPath}
+
+	// only what describes the user's terminal or display, never root's session
+	for _, key := range []string{"LANG", "LANGUAGE", "LC_ALL", "TERM", "DISPLAY", "WAYLAND_DISPLAY"} {
+		if val, found := os.LookupEnv(key); found {
+			cmd.Env = append(cmd.Env, key+"="+val)
+		}
+	}
+
+	cmd.Env = append(cmd.Env, extra...)
+	return nil
+}
+
+// AsUser calls fn on a thread that accesses files with the permissions of the
+// provided user instead of root's (i.e. files are created as owned by the user
+// and anything the user couldn't read or write is refused). When not running as
+// root, fn is simply called.
+func AsUser(u *user.User, fn func() error) error {
+	if os.Getuid() != 0 {
+		return fn()
+	}
+
+	cred, err := CredentialOf(u)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer LogRecover()
+
+		// never unlocked: the thread is thrown away when this goroutine exits
+		// rather than being reused with the user's file permissions
+		runtime.LockOSThread()
+
+		// raw calls only affect this thread (unlike syscall.Setgroups)
+		if _, _, e := syscall.RawSyscall(syscall.SYS_SETGROUPS, 0, 0, 0); e != 0 {
+			done <- fmt.Errorf("unable to drop groups: %w", e)
+			return
+		}
+
+		syscall.RawSyscall(syscall.SYS_SETFSGID, uintptr(cred.Gid), 0, 0)
+		syscall.RawSyscall(syscall.SYS_SETFSUID, uintptr(cred.Uid), 0, 0)
+
+		// each returns the previous value, confirming the change
+		gid, _, _ := syscall.RawSyscall(syscall.SYS_SETFSGID, uintptr(cred.Gid), 0, 0)
+		uid, _, _ := syscall.RawSyscall(syscall.SYS_SETFSUID, uintptr(cred.Uid), 0, 0)
+		if uint32(uid) != cred.Uid || uint32(gid) != cred.Gid {
+			done <- fmt.Errorf("unable to access files as %s", u.Username)
+			return
+		}
+
+		done <- fn()
+	}()
+
+	return <-done
+}
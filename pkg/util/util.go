@@ -4,6 +4,8 @@ package util
 import (
 	"fmt"
 	"os"
+	"os/user"
+	"strconv"
 	"syscall"
 
 	"github.com/mattn/go-isatty"
@@ -34,6 +36,39 @@ func BeNice(priority int) error {
 	return nil
 }
 
+// InvokingUser returns the user that started this process through sudo or
+// pkexec. If not running as root, the current user is returned.
+func InvokingUser() (*user.User, error) {
+	if os.Getuid() != 0 {
+		return user.Current()
+	}
+
+	for _, key := range []string{"SUDO_UID", "PKEXEC_UID"} {
+		uid := os.Getenv(key)
+		if uid != "" {
+			return user.LookupId(uid)
+		}
+	}
+
+	return nil, fmt.Errorf("unable to determine the user that started this process as root")
+}
+
+// CredentialOf returns the credential needed to run a command as the provided
+// user.
+func CredentialOf(u *user.User) (*syscall.Credential, error) {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse uid of %s: %w", u.Username, err)
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse gid of %s: %w", u.Username, err)
+	}
+
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
 // IsTTY determines if a file handle is attached to a TTY.
 func IsTTY(f *os.File) bool {
 	return isatty.IsTerminal(f.Fd())